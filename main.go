@@ -1,13 +1,24 @@
 package main
 
 import (
+	"flag"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	. "github.com/stepga/godible/src"
 )
 
 func main() {
+	sinkSpec := flag.String("sink", "alsa", "audio output: alsa, discard or wav:<path>")
+	listen := flag.String("listen", HTTP_LISTEN_DEFAULT, "address of the web interface (redirecting to -tls-listen, if set)")
+	tlsListen := flag.String("tls-listen", "", "address of the HTTPS web interface with a self-signed certificate, e.g. :443")
+	adminPassword := flag.String("admin-password", "", "password of the web interface's admin role (enables the authentication)")
+	remotePin := flag.String("remote-pin", "", "PIN of the web interface's remote control role")
+	flag.Parse()
+
 	SetDefaultLogger(slog.LevelDebug)
 
 	slog.Info("remount /perm to read-only initially")
@@ -16,20 +27,27 @@ func main() {
 		slog.Error("RemountPerm failed", "err", err)
 	}
 
-	player, err := NewPlayer()
+	sink, err := NewAudioSink(*sinkSpec)
+	if err != nil {
+		slog.Error("NewAudioSink failed", "err", err)
+		os.Exit(1)
+	}
+
+	player, err := NewPlayer(sink)
 	if err != nil {
 		slog.Error("NewPlayer: initializing player failed", "err", err)
 		os.Exit(1)
 	}
 
-	err = RegisterPinFunc(
+	err = RegisterPinHoldFunc(
 		"GPIO4",
 		func() {
 			player.Command(PREVIOUS)
 		},
-		func() {
-			slog.Info("TODO: implement long previous button")
+		func(held time.Duration) {
+			player.Scrub(false, held)
 		},
+		player.StopScrub,
 	)
 	if err != nil {
 		slog.Error("RegisterPinFunc failed", "err", err)
@@ -43,25 +61,32 @@ func main() {
 		},
 		func() {
 			slog.Info("rebooting device")
+			player.Shutdown()
 			Reboot()
 		},
 	)
 
-	err = RegisterPinFunc(
+	err = RegisterPinHoldFunc(
 		"GPIO24",
 		func() {
 			player.Command(NEXT)
 		},
-		func() {
-			slog.Info("TODO: implement long next button")
+		func(held time.Duration) {
+			player.Scrub(true, held)
 		},
+		player.StopScrub,
 	)
 	if err != nil {
 		slog.Error("RegisterPinFunc failed", "err", err)
 		os.Exit(1)
 	}
 
-	err = InitHttpHandlers(player)
+	err = InitHttpHandlers(player, HttpConfig{
+		Listen:        *listen,
+		TlsListen:     *tlsListen,
+		AdminPassword: *adminPassword,
+		RemotePin:     *remotePin,
+	})
 	if err != nil {
 		slog.Error("InitHttpHandlers failed", "err", err)
 		os.Exit(1)
@@ -72,5 +97,14 @@ func main() {
 	rfid.RfidUidSender(uidPassChan)
 	player.RfidUidReceiver(uidPassChan)
 
+	go func() {
+		exitSignal := make(chan os.Signal, 1)
+		signal.Notify(exitSignal, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-exitSignal
+		slog.Info("shutting down", "signal", sig)
+		player.Shutdown()
+		os.Exit(0)
+	}()
+
 	player.Play()
 }
@@ -0,0 +1,342 @@
+package godible
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// API_PREFIX is the path prefix of the versioned REST API. Incompatible
+// changes of the API require a new version.
+const API_PREFIX = "/api/v1"
+
+// apiMaxBodySize limits the size of the REST API's request bodies.
+const apiMaxBodySize = 64 << 10
+
+// ApiError is the body of the REST API's error responses.
+type ApiError struct {
+	Error string `json:"error"`
+}
+
+// ApiTrack represents a Track in the REST API.
+type ApiTrack struct {
+	Path      string `json:"path"`
+	Directory string `json:"directory"`
+	Name      string `json:"name"`
+	// Position and Duration are given in milliseconds
+	Position int64  `json:"position"`
+	Duration int64  `json:"duration"`
+	RfidUid  string `json:"rfid_uid,omitempty"`
+	Tags     Tags   `json:"tags"`
+}
+
+// ApiDirectory represents a directory containing Tracks in the REST API.
+type ApiDirectory struct {
+	Path string `json:"path"`
+	// Name is the directory's path relative to the data directory
+	Name    string `json:"name"`
+	Tracks  int    `json:"tracks"`
+	RfidUid string `json:"rfid_uid,omitempty"`
+}
+
+// registerApi registers the handlers of the REST API. The commands are
+// executed by runCommand, just like the commands received via websocket, and
+// require the role of commandRole.
+func (p *PlayerHandlerPassthrough) registerApi(mux *http.ServeMux) {
+	remote := func(handler http.HandlerFunc) http.HandlerFunc {
+		return apiSameOrigin(p.requireRole(ROLE_REMOTE, handler))
+	}
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		return apiSameOrigin(p.requireRole(ROLE_ADMIN, handler))
+	}
+	mux.HandleFunc("GET "+API_PREFIX+"/state", remote(p.apiState))
+	mux.HandleFunc("GET "+API_PREFIX+"/tracks", remote(p.apiTracks))
+	mux.HandleFunc("GET "+API_PREFIX+"/directories", remote(p.apiDirectories))
+	for _, name := range []string{"play", "pause", "toggle", "next", "previous", "rescan"} {
+		mux.HandleFunc("POST "+API_PREFIX+"/"+name, remote(p.apiSimpleCommand(name)))
+	}
+	mux.HandleFunc("POST "+API_PREFIX+"/seek", remote(p.apiSeek))
+	mux.HandleFunc("POST "+API_PREFIX+"/volume", remote(p.apiVolume))
+	mux.HandleFunc("POST "+API_PREFIX+"/commands/{name}", remote(p.apiCommand))
+	mux.HandleFunc("GET "+API_PREFIX+"/rfid", remote(p.apiRfidMappings))
+	mux.HandleFunc("GET "+API_PREFIX+"/rfid/{uid}", remote(p.apiGetRfidMapping))
+	mux.HandleFunc("PUT "+API_PREFIX+"/rfid/{uid}", admin(p.apiPutRfidMapping))
+	mux.HandleFunc("DELETE "+API_PREFIX+"/rfid/{uid}", admin(p.apiDeleteRfidMapping))
+	mux.HandleFunc(API_PREFIX+"/", func(w http.ResponseWriter, r *http.Request) {
+		apiFallback(mux, w, r)
+	})
+}
+
+// apiSameOrigin rejects state changing requests from pages of other origins
+// (see checkOrigin). Browsers send some of them without a CORS preflight,
+// e.g. POST requests of JSON as text/plain.
+func apiSameOrigin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" && !checkOrigin(r) {
+			writeApiError(w, fmt.Errorf("%w: cross origin request", errForbidden))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// apiFallback responds to requests not matching any handler of the REST
+// API. As it matches all methods, it also reports the wrong methods of
+// existing resources, which the mux would have reported otherwise.
+func apiFallback(mux *http.ServeMux, w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range []string{"GET", "POST", "PUT", "DELETE"} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != API_PREFIX+"/" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		writeApiError(w, fmt.Errorf("%w: %s", errNotFound, r.URL.Path))
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeApiJson(w, http.StatusMethodNotAllowed, ApiError{Error: "method not allowed: " + r.Method})
+}
+
+func writeApiJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("api: writing response failed", "err", err)
+	}
+}
+
+// apiErrorStatus maps the error of a command to a HTTP status code.
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalidArgument):
+		return http.StatusBadRequest
+	case errors.Is(err, errNotFound), errors.Is(err, errUnknownCommand):
+		return http.StatusNotFound
+	case errors.Is(err, errConflict):
+		return http.StatusConflict
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeApiError(w http.ResponseWriter, err error) {
+	status := apiErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		slog.Error("api: request failed", "err", err)
+	}
+	writeApiJson(w, status, ApiError{Error: err.Error()})
+}
+
+// readApiJson decodes the request's JSON body into v.
+func readApiJson(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: request body: %s", errInvalidArgument, err)
+	}
+	return nil
+}
+
+// runApiCommand executes the command, if the user is permitted to, and
+// responds with the resulting state.
+func (p *PlayerHandlerPassthrough) runApiCommand(w http.ResponseWriter, r *http.Request, name string, payload string) {
+	err := authorize(p.role(r), commandRole(name))
+	if err == nil {
+		err = p.runCommand(name, payload)
+		p.notify()
+	}
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusOK, p.state())
+}
+
+func (p *PlayerHandlerPassthrough) apiState(w http.ResponseWriter, r *http.Request) {
+	writeApiJson(w, http.StatusOK, p.state())
+}
+
+func (p *PlayerHandlerPassthrough) apiTracks(w http.ResponseWriter, r *http.Request) {
+	tracks := p.tracks()
+	ret := make([]ApiTrack, len(tracks))
+	for i, track := range tracks {
+		ret[i] = ApiTrack{
+			Path:      track.Path,
+			Directory: track.DirnameFull(),
+			Name:      track.Basename(),
+			Position:  track.position.Milliseconds(),
+			Duration:  track.duration.Milliseconds(),
+			RfidUid:   p.rtm.GetUid(track),
+			Tags:      track.Tags(),
+		}
+	}
+	writeApiJson(w, http.StatusOK, ret)
+}
+
+func (p *PlayerHandlerPassthrough) apiDirectories(w http.ResponseWriter, r *http.Request) {
+	ret := []ApiDirectory{}
+	indices := make(map[string]int)
+	for _, track := range p.tracks() {
+		directory := track.DirnameFull()
+		if i, ok := indices[directory]; ok {
+			ret[i].Tracks++
+			continue
+		}
+		indices[directory] = len(ret)
+		ret = append(ret, ApiDirectory{
+			Path:    directory,
+			Name:    dirnameShow(directory),
+			Tracks:  1,
+			RfidUid: p.rtm.GetDirectoryUid(directory),
+		})
+	}
+	writeApiJson(w, http.StatusOK, ret)
+}
+
+// apiSimpleCommand returns the handler of a command without payload.
+func (p *PlayerHandlerPassthrough) apiSimpleCommand(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.runApiCommand(w, r, name, "")
+	}
+}
+
+// apiSeek moves the current Track either to the position or by the offset
+// given in seconds, e.g. {"position": 90} or {"offset": -10}.
+func (p *PlayerHandlerPassthrough) apiSeek(w http.ResponseWriter, r *http.Request) {
+	var seek struct {
+		Position *int `json:"position"`
+		Offset   *int `json:"offset"`
+	}
+	err := readApiJson(w, r, &seek)
+	if err == nil && (seek.Position == nil) == (seek.Offset == nil) {
+		err = fmt.Errorf("%w: either position or offset is required", errInvalidArgument)
+	}
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	if seek.Position != nil {
+		p.runApiCommand(w, r, "seek", strconv.Itoa(*seek.Position))
+		return
+	}
+	p.runApiCommand(w, r, "seekrelative", strconv.Itoa(*seek.Offset))
+}
+
+// apiVolume sets the volume in percent, e.g. {"volume": 40}.
+func (p *PlayerHandlerPassthrough) apiVolume(w http.ResponseWriter, r *http.Request) {
+	var volume struct {
+		Volume *int `json:"volume"`
+	}
+	err := readApiJson(w, r, &volume)
+	if err == nil && volume.Volume == nil {
+		err = fmt.Errorf("%w: volume is required", errInvalidArgument)
+	}
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	p.runApiCommand(w, r, "volume", strconv.Itoa(*volume.Volume))
+}
+
+// apiCommand executes any command of the websocket API, e.g.
+// {"payload": "directory"} for the command "repeatmode".
+func (p *PlayerHandlerPassthrough) apiCommand(w http.ResponseWriter, r *http.Request) {
+	var command struct {
+		Payload string `json:"payload"`
+	}
+	if r.ContentLength != 0 {
+		err := readApiJson(w, r, &command)
+		if err != nil {
+			writeApiError(w, err)
+			return
+		}
+	}
+	p.runApiCommand(w, r, r.PathValue("name"), command.Payload)
+}
+
+func (p *PlayerHandlerPassthrough) apiRfidMappings(w http.ResponseWriter, r *http.Request) {
+	writeApiJson(w, http.StatusOK, p.rtm.Mappings())
+}
+
+// rfidMapping returns the mapping of the given RFID UID.
+func (p *PlayerHandlerPassthrough) rfidMapping(uid string) (RfidMapping, error) {
+	for _, mapping := range p.rtm.Mappings() {
+		if mapping.Uid == uid {
+			return mapping, nil
+		}
+	}
+	return RfidMapping{}, fmt.Errorf("%w: rfid uid %q", errNotFound, uid)
+}
+
+func (p *PlayerHandlerPassthrough) apiGetRfidMapping(w http.ResponseWriter, r *http.Request) {
+	mapping, err := p.rfidMapping(r.PathValue("uid"))
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	writeApiJson(w, http.StatusOK, mapping)
+}
+
+// apiPutRfidMapping links the RFID UID to a track, e.g. {"path": ...}, or to
+// a directory, e.g. {"directory": ...}.
+func (p *PlayerHandlerPassthrough) apiPutRfidMapping(w http.ResponseWriter, r *http.Request) {
+	uid := r.PathValue("uid")
+	var put struct {
+		Path      string `json:"path"`
+		Directory string `json:"directory"`
+	}
+	err := readApiJson(w, r, &put)
+	if err == nil && (put.Path == "") == (put.Directory == "") {
+		err = fmt.Errorf("%w: either path or directory is required", errInvalidArgument)
+	}
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	var track *Track
+	if put.Path != "" {
+		track = p.findTrack(put.Path)
+	} else {
+		put.Directory = filepath.Clean(put.Directory)
+		track = p.findDirectoryTrack(put.Directory)
+	}
+	if track == nil {
+		writeApiError(w, fmt.Errorf("%w: track or directory %q", errNotFound, put.Path+put.Directory))
+		return
+	}
+	status := http.StatusOK
+	if p.rtm.PutMapping(uid, track, put.Directory) {
+		status = http.StatusCreated
+	}
+	p.notify()
+	mapping, err := p.rfidMapping(uid)
+	if err != nil {
+		writeApiError(w, err)
+		return
+	}
+	writeApiJson(w, status, mapping)
+}
+
+func (p *PlayerHandlerPassthrough) apiDeleteRfidMapping(w http.ResponseWriter, r *http.Request) {
+	uid := r.PathValue("uid")
+	if !p.rtm.DeleteMapping(uid) {
+		writeApiError(w, fmt.Errorf("%w: rfid uid %q", errNotFound, uid))
+		return
+	}
+	p.notify()
+	w.WriteHeader(http.StatusNoContent)
+}
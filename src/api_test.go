@@ -0,0 +1,93 @@
+package godible
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApi(t *testing.T) {
+	p := newPlayerHandlerPassthrough(newLibraryTestPlayer(t, "a/1.wav", "a/2.wav", "b/1.wav"))
+	mux := http.NewServeMux()
+	p.registerApi(mux)
+
+	request := func(method string, path string, body string, expectedStatus int, v any) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(method, API_PREFIX+path, strings.NewReader(body)))
+		if recorder.Code != expectedStatus {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, expectedStatus, recorder.Code, recorder.Body)
+		}
+		if v != nil {
+			err := json.Unmarshal(recorder.Body.Bytes(), v)
+			if err != nil {
+				t.Fatalf("%s %s: invalid response: %s", method, path, err)
+			}
+		}
+	}
+
+	var tracks []ApiTrack
+	request("GET", "/tracks", "", http.StatusOK, &tracks)
+	if len(tracks) != 3 {
+		t.Errorf("expected 3 tracks, got %v", tracks)
+	}
+	var directories []ApiDirectory
+	request("GET", "/directories", "", http.StatusOK, &directories)
+	if len(directories) != 2 || directories[0].Tracks != 2 {
+		t.Errorf("unexpected directories: %v", directories)
+	}
+
+	// errors are reported with status codes and JSON bodies
+	var apiError ApiError
+	request("POST", "/volume", `{"volume": "loud"}`, http.StatusBadRequest, &apiError)
+	if apiError.Error == "" {
+		t.Errorf("expected an error message")
+	}
+	request("POST", "/commands/sortorder", `{"payload": "random"}`, http.StatusBadRequest, nil)
+	request("POST", "/commands/unknown", "", http.StatusNotFound, nil)
+	request("DELETE", "/tracks", "", http.StatusMethodNotAllowed, nil)
+	request("GET", "/unknown", "", http.StatusNotFound, &apiError)
+
+	// state changing requests of other origins are rejected
+	for origin, forbidden := range map[string]bool{"http://example.com": false, "http://evil.example": true} {
+		recorder := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", API_PREFIX+"/commands/delete", strings.NewReader(`{"payload": "missing"}`))
+		r.Header.Set("Origin", origin)
+		mux.ServeHTTP(recorder, r)
+		if (recorder.Code == http.StatusForbidden) != forbidden {
+			t.Errorf("POST from %s: unexpected status %d", origin, recorder.Code)
+		}
+	}
+
+	var state HttpState
+	request("POST", "/commands/repeatmode", `{"payload": "directory"}`, http.StatusOK, &state)
+	if state.RepeatMode != REPEAT_DIRECTORY {
+		t.Errorf("expected the repeat mode to be set, got %s", state.RepeatMode)
+	}
+
+	// RFID mappings
+	directory := filepath.Join(p.dataDir, "a")
+	var mapping RfidMapping
+	request("PUT", "/rfid/1234", `{"directory": "`+directory+`"}`, http.StatusCreated, &mapping)
+	if mapping.Uid != "1234" || mapping.Directory != directory || !mapping.Resolved {
+		t.Errorf("unexpected mapping: %+v", mapping)
+	}
+	track := filepath.Join(p.dataDir, "b", "1.wav")
+	mapping = RfidMapping{}
+	request("PUT", "/rfid/1234", `{"path": "`+track+`"}`, http.StatusOK, &mapping)
+	if mapping.Path != track || mapping.Directory != "" {
+		t.Errorf("expected the mapping to be replaced, got %+v", mapping)
+	}
+	request("PUT", "/rfid/5678", `{"path": "/missing.wav"}`, http.StatusNotFound, nil)
+	var mappings []RfidMapping
+	request("GET", "/rfid", "", http.StatusOK, &mappings)
+	if len(mappings) != 1 {
+		t.Errorf("expected one mapping, got %v", mappings)
+	}
+	request("DELETE", "/rfid/1234", "", http.StatusNoContent, nil)
+	request("GET", "/rfid/1234", "", http.StatusNotFound, nil)
+	request("DELETE", "/rfid/1234", "", http.StatusNotFound, nil)
+}
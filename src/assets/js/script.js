@@ -5,6 +5,26 @@
 var time_current_lock = false;
 /* is_playing is needed to set the correct play/pause icon */
 var is_playing = false;
+/*
+ * volume_lock and max_volume_lock prevent updateUI from resetting the
+ * respective slider while it is being moved
+ */
+var volume_lock = false;
+var max_volume_lock = false;
+
+/*
+ * escapeHTML escapes a value for the HTML templates below; all values
+ * derived from the files (names, paths, tags) have to be escaped, as they
+ * may contain markup
+ */
+function escapeHTML(value) {
+	return String(value ?? "")
+		.replaceAll("&", "&amp;")
+		.replaceAll("<", "&lt;")
+		.replaceAll(">", "&gt;")
+		.replaceAll('"', "&quot;")
+		.replaceAll("'", "&#39;");
+}
 
 const createRowHTML = ({
 	basename,
@@ -14,13 +34,16 @@ const createRowHTML = ({
 	fullpath_hash_sum,
 	rfid_uid,
 	hash_sum,
-
+	...tags
 }) => `
 <tr id="${fullpath_hash_sum}"
-  data-basename="${basename}"
-  data-fullpath="${fullpath}"
+  data-basename="${escapeHTML(basename)}"
+  data-fullpath="${escapeHTML(fullpath)}"
   data-hash_sum="${hash_sum}">
-  <td>${basename}</td>
+  <td>
+    ${escapeHTML(basename)}
+    <br><small class="text-muted">${escapeHTML(tagsToText(tags))}</small>
+  </td>
   <td class="text-center">${current_seconds} / ${duration_seconds}</td>
   <td class="text-center">
     <button
@@ -28,12 +51,55 @@ const createRowHTML = ({
       class="btn btn-warning mb-1"
       type="button">
       <i class="fa fa-wifi">
-      ${rfid_uid}
+      ${escapeHTML(rfid_uid)}
       </i>
     </button>
+    ${createBookmarkResetButtonHTML(fullpath_hash_sum, rfid_uid)}
+    ${createLibraryButtonsHTML()}
   </td>
 </tr>`;
 
+/* createLibraryButtonsHTML creates the buttons to delete, rename and move a track or directory */
+const createLibraryButtonsHTML = () => `
+<span class="text-nowrap">
+  <button class="btn btn-outline-secondary btn-sm mb-1 library-rename" type="button" title="Umbenennen">
+    <i class="fa fa-pencil"></i>
+  </button>
+  <button class="btn btn-outline-secondary btn-sm mb-1 library-move" type="button" title="Verschieben">
+    <i class="fa fa-folder-open"></i>
+  </button>
+  <button class="btn btn-outline-danger btn-sm mb-1 library-delete" type="button" title="Löschen">
+    <i class="fa fa-trash"></i>
+  </button>
+</span>`;
+
+/* tagsToText summarizes a track's tags, e.g. "3. Title - Artist - Album (2001, Genre)" */
+function tagsToText(tags) {
+	if (tags == null) {
+		return "";
+	}
+	let title = tags.title || "";
+	if (tags.track_number) {
+		title = (tags.disc_number ? tags.disc_number + "-" : "") + tags.track_number + ". " + title;
+	}
+	let text = [title, tags.artist, tags.album].filter(Boolean).join(" - ");
+	let details = [tags.year, tags.genre].filter(Boolean).join(", ");
+	if (details != "") {
+		text += " (" + details + ")";
+	}
+	return text;
+}
+
+/* a rfid uid's bookmark can be reset to the beginning of its track/directory */
+const createBookmarkResetButtonHTML = (hash_sum, rfid_uid) => rfid_uid == "" ? "" : `
+<button
+  id="bookmark_reset_${hash_sum}"
+  class="btn btn-warning mb-1"
+  data-rfid_uid="${escapeHTML(rfid_uid)}"
+  type="button">
+  <i class="fa fa-undo"></i>
+</button>`;
+
 
 // ----------
 // TODO order
@@ -60,7 +126,7 @@ function initializePlayerUI() {
 		const time_current_date_str = $("#time_current").text();
 		const time_current_seconds = HHMMSSToSeconds(time_current_date_str);
 		time_current_lock = false;
-		websocket.send('{ "type": "slide", "payload": "' + time_current_seconds + '"}');
+		websocket.send('{ "type": "seek", "payload": "' + time_current_seconds + '"}');
 	}
 	slider.on("mouseup", sliderUpEvent);
 	slider.on("touchend", sliderUpEvent);
@@ -71,11 +137,61 @@ function initializePlayerUI() {
 	$("#next").on("click", function() {
 		websocket.send('{ "type": "next", "payload": ""}');
 	});
+	$("#rewind").on("click", function() {
+		websocket.send('{ "type": "seekrelative", "payload": "-30"}');
+	});
+	$("#forward").on("click", function() {
+		websocket.send('{ "type": "seekrelative", "payload": "30"}');
+	});
 	$("#toggle").on("click", function() {
 		websocket.send('{ "type": "toggle", "payload": ""}');
 		is_playing = !is_playing;
 		setToggleIcon();
 	});
+
+	$("#volume_down").on("click", function() {
+		websocket.send('{ "type": "volumedown", "payload": ""}');
+	});
+	$("#volume_up").on("click", function() {
+		websocket.send('{ "type": "volumeup", "payload": ""}');
+	});
+	let volumeSlider = $("#volume_slider");
+	volumeSlider.on("input", function() {
+		volume_lock = true;
+		$("#volume").text(volumeSlider.val());
+	});
+	volumeSlider.on("change", function() {
+		volume_lock = false;
+		websocket.send(JSON.stringify({ type: "volume", payload: volumeSlider.val() }));
+	});
+	let maxVolumeSlider = $("#max_volume");
+	maxVolumeSlider.on("input", function() {
+		max_volume_lock = true;
+		$("#max_volume_value").text(maxVolumeSlider.val());
+	});
+	maxVolumeSlider.on("change", function() {
+		max_volume_lock = false;
+		websocket.send(JSON.stringify({ type: "maxvolume", payload: maxVolumeSlider.val() }));
+	});
+
+	$("#sleep_timer").on("change", function() {
+		websocket.send(JSON.stringify({ type: "sleeptimer", payload: $(this).val() }));
+	});
+	$("#sort_order").on("change", function() {
+		websocket.send(JSON.stringify({ type: "sortorder", payload: $(this).val() }));
+	});
+	$("#directory_order").on("change", function() {
+		websocket.send(JSON.stringify({ type: "directoryorder", payload: $(this).val() }));
+	});
+	$("#repeat_mode").on("change", function() {
+		websocket.send(JSON.stringify({ type: "repeatmode", payload: $(this).val() }));
+	});
+	$("#rescan").on("click", function() {
+		websocket.send(JSON.stringify({ type: "rescan", payload: "" }));
+	});
+	$("#shuffle").on("change", function() {
+		websocket.send(JSON.stringify({ type: "shuffle", payload: String($(this).prop("checked")) }));
+	});
 }
 
 function HHMMSSToSeconds(date) {
@@ -127,6 +243,8 @@ function updateUI(data) {
 
 	// TODO: update fields only if content really changed
 	$("#track_name").text(json.name);
+	$("#track_tags").text(tagsToText(json.tags));
+	$("#scope").text(json.scope);
 	$("#time_total").text(secondsToHHMMSS(json.duration));
 	$("#slider").attr({ "max": json.duration });
 	if (time_current_lock == false) {
@@ -134,6 +252,30 @@ function updateUI(data) {
 		$("#slider").val(json.duration_current);
 	}
 
+	if (volume_lock == false) {
+		$("#volume").text(json.volume);
+		$("#volume_slider").val(json.volume);
+	}
+	if (max_volume_lock == false) {
+		$("#max_volume_value").text(json.max_volume);
+		$("#max_volume").val(json.max_volume);
+	}
+
+	if (json.sleep_timer_end_of_track) {
+		$("#sleep_timer_left").text("Stopp am Ende des Titels");
+	} else if (json.sleep_timer > 0) {
+		$("#sleep_timer_left").text("Stopp in " + secondsToHHMMSS(json.sleep_timer));
+	} else {
+		$("#sleep_timer_left").text("");
+		$("#sleep_timer").val("0");
+	}
+
+	$("#sort_order").val(json.sort_order);
+	$("#directory_order").val(json.directory_order);
+	$("#repeat_mode").val(json.repeat_mode);
+	$("#shuffle").prop("checked", json.shuffle);
+	updateRescanUI(json.rescan);
+
 	$("#alertBoxTrackName").text(json.rfid_track_training.name);
 	$("#alertBoxSeconds").text(json.rfid_track_training.time_left);
 	$("#alertBox").toggle(json.rfid_track_training.time_left > 0)
@@ -154,6 +296,16 @@ function updateRfidButtonsClickEvent() {
 		});
 		$(this).addClass("clickEventHandlerRegistered");
 	});
+	$('button[id*=bookmark_reset_]:not(.clickEventHandlerRegistered)').each(function(_index) {
+		$(this).on("click", function() {
+			const msg = JSON.stringify({
+				type: "rfidbookmarkreset",
+				payload: $(this).data('rfid_uid')
+			});
+			websocket.send(msg);
+		});
+		$(this).addClass("clickEventHandlerRegistered");
+	});
 }
 
 /* create a track row's respective directory tbody, in which the row can be inserted. */
@@ -161,19 +313,28 @@ function createRowTbody(row) {
 	$(`<tbody
 		id="${row['dirname_hash_sum']}"
 		class="table-group-divider">
-		<tr data-fullpath="${row['dirname_full']}">
-			<th colspan=2>${row['dirname_show']}</th>
+		<tr data-fullpath="${escapeHTML(row['dirname_full'])}">
+			<th colspan=2>${escapeHTML(row['dirname_show'])}</th>
 			<td class="text-center">
 			<button id="rfid_button_${row['dirname_hash_sum']}"
 				class="btn btn-warning mb-1"
 				type="button">
-				<i class="fa fa-wifi"></i>
+				<i class="fa fa-wifi">
+				${escapeHTML(row['dirname_rfid_uid'])}
+				</i>
 			</button>
+			<span id="bookmark_reset_container_${row['dirname_hash_sum']}">
+			${createBookmarkResetButtonHTML(row['dirname_hash_sum'], row['dirname_rfid_uid'])}
+			</span>
+			${createLibraryButtonsHTML()}
 			</td>
 		</tr>
 	</tbody>`).appendTo('table');
 }
 
+/* table_rows are the rows the table currently shows, in their order */
+var table_rows = [];
+
 function updateTable(data) {
 	if (data == null || data == "null") {
 		console.error("updateTable: no data passed");
@@ -187,11 +348,68 @@ function updateTable(data) {
 		console.error("updateTable: " + e);
 		return
 	}
+	renderRows(json);
+}
+
+/* updateTableDiff applies a rows_diff event to the shown rows */
+function updateTableDiff(data) {
+	let diff;
+	try {
+		diff = JSON.parse(data);
+	} catch (e) {
+		console.error("updateTableDiff: " + e);
+		return
+	}
+
+	let rows = new Map(table_rows.map((row) => [row['fullpath_hash_sum'], row]));
+	for (let removed of diff.removed) {
+		rows.delete(removed);
+	}
+	for (let changed of diff.changed) {
+		rows.set(changed['fullpath_hash_sum'], changed);
+	}
+	let order = diff.order;
+	if (order == null) {
+		order = table_rows.map((row) => row['fullpath_hash_sum']);
+	}
+	renderRows(order.filter((id) => rows.has(id)).map((id) => rows.get(id)));
+}
+
+/* updatePosition updates the current track's position (see the position event) */
+function updatePosition(data) {
+	let position;
+	try {
+		position = JSON.parse(data);
+	} catch (e) {
+		console.error("updatePosition: " + e);
+		return
+	}
+	if (time_current_lock == false) {
+		$("#time_current").text(secondsToHHMMSS(position.duration_current));
+		$("#slider").val(position.duration_current);
+	}
+	let row = table_rows.find((row) => row['fullpath_hash_sum'] == position.current);
+	if (row != null) {
+		$("#" + position.current + " td:nth-child(2)").text(
+			position.duration_current + " / " + row['duration_seconds']);
+	}
+}
 
+/* renderRows updates the table to show the given rows */
+function renderRows(json) {
+	table_rows = json;
 	const rowsHTML = json.map(createRowHTML);
 	for (let [index, rowHTML] of rowsHTML.entries()) {
 		let rowStruct = json[index];
 
+		// update the directory's rfid uid
+		let dirnameRfidButtonIcon = $("#rfid_button_" + rowStruct['dirname_hash_sum'] + " i");
+		if (dirnameRfidButtonIcon.text().trim() != rowStruct['dirname_rfid_uid']) {
+			dirnameRfidButtonIcon.text(rowStruct['dirname_rfid_uid']);
+			$("#bookmark_reset_container_" + rowStruct['dirname_hash_sum']).html(
+				createBookmarkResetButtonHTML(rowStruct['dirname_hash_sum'], rowStruct['dirname_rfid_uid']));
+		}
+
 		// update existing track row
 		var element = $("#" + rowStruct['fullpath_hash_sum']);
 		if (element.length !== 0) {
@@ -211,13 +429,50 @@ function updateTable(data) {
 		// insert new track row
 		$(rowHTML).appendTo(tbody);
 	}
+	pruneTable(json);
+	sortTable(json);
 	updateRfidButtonsClickEvent();
 }
 
+/* pruneTable removes the rows of removed tracks and the emptied directory tbodies */
+function pruneTable(rows) {
+	const ids = new Set(rows.map((row) => row['fullpath_hash_sum']));
+	$("tbody tr[id]").each(function() {
+		if (!ids.has(this.id)) {
+			$(this).remove();
+		}
+	});
+	$("tbody").each(function() {
+		if ($(this).find("tr[id]").length === 0) {
+			$(this).remove();
+		}
+	});
+}
+
+/* rows_order is the order of the rows the table is currently sorted by */
+var rows_order = "";
+
+/* sortTable moves the directory tbodies and their rows into the rows' order */
+function sortTable(rows) {
+	const order = rows.map((row) => row['fullpath_hash_sum']).join(",");
+	if (order == rows_order) {
+		return;
+	}
+	const tbodies = new Set(rows.map((row) => row['dirname_hash_sum']));
+	for (let tbody of tbodies) {
+		$("#" + tbody).appendTo('table');
+	}
+	for (let row of rows) {
+		$("#" + row['fullpath_hash_sum']).appendTo("#" + row['dirname_hash_sum']);
+	}
+	rows_order = order;
+}
+
 function initializeWebsocket() {
 	if (typeof(websocket) == 'undefined' || websocket == null) {
 		console.log('initialize new websocket connection')
-		websocket = new WebSocket("ws://"+window.location.host+"/ws");
+		let protocol = (window.location.protocol == "https:") ? "wss://" : "ws://";
+		websocket = new WebSocket(protocol+window.location.host+"/ws");
 	}
 	websocket.onmessage = function(event) {
 		let data = JSON.parse(event.data);
@@ -225,9 +480,15 @@ function initializeWebsocket() {
 			case "rows":
 				updateTable(data['payload']);
 				break;
+			case "rows_diff":
+				updateTableDiff(data['payload']);
+				break;
 			case "state":
 				updateUI(data['payload']);
 				break;
+			case "position":
+				updatePosition(data['payload']);
+				break;
 			default:
 				console.error("websocket: unknown api request type '" + data['type'] + "'")
 		}
@@ -235,6 +496,21 @@ function initializeWebsocket() {
 	websocket.onerror = function(event) {
 		console.error("websocket error: " + event.data);
 	}
+	websocket.onclose = function(event) {
+		// reconnect; the server starts over with a snapshot
+		console.log("websocket closed, reconnect");
+		websocket = null;
+		setTimeout(function() {
+			// an expired session requires to login again
+			fetch("/api/v1/state").then(function(response) {
+				if (response.status == 401) {
+					window.location.href = "/login";
+					return;
+				}
+				initializeWebsocket();
+			}).catch(initializeWebsocket);
+		}, 1000);
+	}
 }
 
 function registerAlertBoxCloseButton() {
@@ -273,8 +549,104 @@ function registerFilterSearch() {
 
 var websocket;
 
+/* updateRescanUI shows the progress of a running (or the result of the last) rescan */
+function updateRescanUI(rescan) {
+	if (rescan == null) {
+		return;
+	}
+	$("#rescan").prop("disabled", rescan.running);
+	$("#rescan_progress").toggleClass("d-none", !rescan.running);
+	let percent = 0;
+	if (rescan.total > 0) {
+		percent = Math.min(100, Math.round(100 * rescan.scanned / rescan.total));
+	}
+	$("#rescan_progress_bar").css("width", percent + "%");
+	if (rescan.error) {
+		$("#rescan_status").text("Einlesen fehlgeschlagen: " + rescan.error);
+	} else if (rescan.running || rescan.scanned > 0) {
+		let text = rescan.scanned + " / " + rescan.total + " Dateien eingelesen, "
+			+ rescan.skipped + " übersprungen, " + rescan.errors + " Fehler";
+		$("#rescan_status").text(rescan.running ? text : text + " (abgeschlossen)");
+	}
+}
+
+/* uploadResultToText summarizes the server's UploadResult */
+function uploadResultToText(result) {
+	if (result.error) {
+		return "Hochladen fehlgeschlagen: " + result.error;
+	}
+	let text = result.accepted.length + " Datei(en) hochgeladen.";
+	for (let rejected of result.rejected) {
+		text += " Abgelehnt: " + rejected.name + " (" + rejected.error + ").";
+	}
+	return text;
+}
+
+function registerUploadForm() {
+	$("#upload_form").on("submit", function(event) {
+		event.preventDefault();
+		const files = $("#upload_files")[0].files;
+		if (files.length == 0) {
+			return;
+		}
+		let formData = new FormData();
+		// the directory has to precede the files
+		formData.append("directory", $("#upload_directory").val());
+		for (let file of files) {
+			formData.append("files", file);
+		}
+		$("#upload_result").text("Lade hoch...");
+		fetch("/upload", { method: "POST", body: formData })
+			.then((response) => response.json())
+			.then((result) => {
+				$("#upload_result").text(uploadResultToText(result));
+				$("#upload_files").val("");
+			})
+			.catch((e) => {
+				$("#upload_result").text("Hochladen fehlgeschlagen: " + e);
+			});
+	});
+}
+
+/* registerLibraryButtons handles the delete, rename and move buttons of all (also future) table rows */
+function registerLibraryButtons() {
+	const fullpathOf = (button) => String($(button).closest("tr").data('fullpath'));
+	const nameOf = (path) => path.replace(/\/+$/, "").split("/").pop();
+	$("table").on("click", "button.library-delete", function() {
+		const path = fullpathOf(this);
+		if (!confirm('"' + nameOf(path) + '" wirklich löschen?')) {
+			return;
+		}
+		websocket.send(JSON.stringify({ type: "delete", payload: path }));
+	});
+	$("table").on("click", "button.library-rename", function() {
+		const path = fullpathOf(this);
+		const name = prompt("Neuer Name:", nameOf(path));
+		if (name == null || name == "" || name == nameOf(path)) {
+			return;
+		}
+		websocket.send(JSON.stringify({
+			type: "rename",
+			payload: JSON.stringify({ path: path, name: name })
+		}));
+	});
+	$("table").on("click", "button.library-move", function() {
+		const path = fullpathOf(this);
+		const directory = prompt("Verschieben in Verzeichnis (z.B. /Hörspiele):", "/");
+		if (directory == null) {
+			return;
+		}
+		websocket.send(JSON.stringify({
+			type: "move",
+			payload: JSON.stringify({ path: path, directory: directory })
+		}));
+	});
+}
+
 $(document).ready(function(){
 	registerFilterSearch();
+	registerUploadForm();
+	registerLibraryButtons();
 	registerAlertBoxCloseButton();
 	initializeWebsocket();
 	initializePlayerUI();
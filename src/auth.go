@@ -0,0 +1,349 @@
+package godible
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SESSIONS_FILE = DATADIR + "sessions.json"
+	// SESSION_COOKIE is the name of the cookie holding the session token
+	SESSION_COOKIE = "godible_session"
+	// SESSION_LIFETIME is the time a session is valid after the login
+	SESSION_LIFETIME = 30 * 24 * time.Hour
+	// LOGIN_FAILURE_DELAY delays the next login of a remote address after a
+	// failed one, which limits the rate of guessing a PIN
+	LOGIN_FAILURE_DELAY = 2 * time.Second
+)
+
+// Role is the permission level of a web interface user.
+type Role string
+
+const (
+	// ROLE_NONE is the role of users, who are not logged in
+	ROLE_NONE Role = ""
+	// ROLE_REMOTE may control the playback (e.g. the kids' remote control)
+	ROLE_REMOTE Role = "remote"
+	// ROLE_ADMIN may additionally change the RFID mappings, the library
+	// and the settings (i.e. the parents)
+	ROLE_ADMIN Role = "admin"
+)
+
+var (
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+)
+
+func (role Role) rank() int {
+	switch role {
+	case ROLE_REMOTE:
+		return 1
+	case ROLE_ADMIN:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// authorize returns an error, if role lacks the permissions of required.
+func authorize(role Role, required Role) error {
+	if role.rank() >= required.rank() {
+		return nil
+	}
+	if role == ROLE_NONE {
+		return fmt.Errorf("%w: login required", errUnauthorized)
+	}
+	return fmt.Errorf("%w: requires role %s", errForbidden, required)
+}
+
+// Session is a login persisted in the SESSIONS_FILE.
+type Session struct {
+	Role    Role      `json:"role"`
+	Expires time.Time `json:"expires"`
+}
+
+// sessionStore holds the sessions by the SHA-256 sum of their tokens, so
+// that the persisted file does not reveal valid cookies.
+type sessionStore struct {
+	mutex    sync.Mutex
+	path     string
+	sessions map[string]Session
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadSessionStore reads the sessions persisted at path, dropping the
+// expired ones. A missing file results in an empty sessionStore.
+func loadSessionStore(path string) (*sessionStore, error) {
+	store := &sessionStore{path: path, sessions: make(map[string]Session)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return store, err
+	}
+	err = json.Unmarshal(data, &store.sessions)
+	if err != nil {
+		return store, fmt.Errorf("decoding sessions %s failed: %w", path, err)
+	}
+	now := time.Now()
+	for hash, session := range store.sessions {
+		if !now.Before(session.Expires) {
+			delete(store.sessions, hash)
+		}
+	}
+	return store, nil
+}
+
+// persist writes the sessions; the caller has to hold the mutex.
+func (store *sessionStore) persist() error {
+	data, err := json.Marshal(store.sessions)
+	if err != nil {
+		return err
+	}
+	return writePermFileMode(store.path, data, 0600)
+}
+
+// create starts a new session of role and returns its token.
+func (store *sessionStore) create(role Role) (string, error) {
+	token := rand.Text()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	for hash, session := range store.sessions {
+		if !now.Before(session.Expires) {
+			delete(store.sessions, hash)
+		}
+	}
+	store.sessions[hashToken(token)] = Session{Role: role, Expires: now.Add(SESSION_LIFETIME)}
+	return token, store.persist()
+}
+
+// role returns the role of the session with token; ROLE_NONE, if there is
+// no such (valid) session.
+func (store *sessionStore) role(token string) Role {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	session, ok := store.sessions[hashToken(token)]
+	if !ok || !time.Now().Before(session.Expires) {
+		return ROLE_NONE
+	}
+	return session.Role
+}
+
+func (store *sessionStore) delete(token string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	hash := hashToken(token)
+	if _, ok := store.sessions[hash]; !ok {
+		return nil
+	}
+	delete(store.sessions, hash)
+	return store.persist()
+}
+
+// auth authenticates the users of the web interface by the admin password
+// or the remote PIN. The session cookies are SameSite=Strict, so they are
+// not sent along with cross-site requests.
+type auth struct {
+	adminPassword string
+	remotePin     string
+	sessions      *sessionStore
+	// loginMutex protects nextLogin
+	loginMutex sync.Mutex
+	// nextLogin holds the earliest time of the next login per remote
+	// address, see LOGIN_FAILURE_DELAY
+	nextLogin    map[string]time.Time
+	failureDelay time.Duration
+}
+
+// newAuth returns the auth of the given secrets with the sessions persisted
+// at sessionsPath. Authentication requires the admin password; the remote
+// PIN is optional.
+func newAuth(adminPassword string, remotePin string, sessionsPath string) (*auth, error) {
+	if adminPassword == "" {
+		return nil, fmt.Errorf("an admin password is required")
+	}
+	if remotePin == adminPassword {
+		return nil, fmt.Errorf("the remote PIN must differ from the admin password")
+	}
+	sessions, err := loadSessionStore(sessionsPath)
+	if err != nil {
+		slog.Error("loading sessions failed, start without", "path", sessionsPath, "err", err)
+	}
+	return &auth{
+		adminPassword: adminPassword,
+		remotePin:     remotePin,
+		sessions:      sessions,
+		nextLogin:     make(map[string]time.Time),
+		failureDelay:  LOGIN_FAILURE_DELAY,
+	}, nil
+}
+
+// login returns the role matching secret, or ROLE_NONE. Each login of the
+// remote address reserves the time until its next login, so that its logins
+// are at least failureDelay apart. The reservation is released on success;
+// other remote addresses are not delayed.
+func (a *auth) login(remote string, secret string) Role {
+	a.loginMutex.Lock()
+	now := time.Now()
+	for address, next := range a.nextLogin {
+		if !next.After(now) {
+			delete(a.nextLogin, address)
+		}
+	}
+	start := now
+	if next, ok := a.nextLogin[remote]; ok {
+		start = next
+	}
+	a.nextLogin[remote] = start.Add(a.failureDelay)
+	a.loginMutex.Unlock()
+	time.Sleep(start.Sub(now))
+
+	role := ROLE_NONE
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(a.adminPassword)) == 1 {
+		role = ROLE_ADMIN
+	} else if a.remotePin != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.remotePin)) == 1 {
+		role = ROLE_REMOTE
+	}
+	if role != ROLE_NONE {
+		a.loginMutex.Lock()
+		delete(a.nextLogin, remote)
+		a.loginMutex.Unlock()
+	}
+	return role
+}
+
+// role returns the role of the request's user. Without authentication,
+// everybody is admin.
+func (p *PlayerHandlerPassthrough) role(r *http.Request) Role {
+	if p.auth == nil {
+		return ROLE_ADMIN
+	}
+	cookie, err := r.Cookie(SESSION_COOKIE)
+	if err != nil {
+		return ROLE_NONE
+	}
+	return p.auth.sessions.role(cookie.Value)
+}
+
+// requireRole wraps handler, so that it is only called for users of the
+// required role. The web interface redirects to the login page, the other
+// handlers (e.g. the REST API) respond with 401 or 403.
+func (p *PlayerHandlerPassthrough) requireRole(required Role, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := authorize(p.role(r), required)
+		if err == nil {
+			handler(w, r)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, API_PREFIX+"/"):
+			writeApiError(w, err)
+		case r.Method == "GET" && r.URL.Path == "/":
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		default:
+			http.Error(w, err.Error(), apiErrorStatus(err))
+		}
+	}
+}
+
+func (p *PlayerHandlerPassthrough) loginHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if p.auth == nil || p.role(r) != ROLE_NONE {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		renderTemplate(w, "header", nil)
+		renderTemplate(w, "login", &Data{})
+	case "POST":
+		if p.auth == nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		remote, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remote = r.RemoteAddr
+		}
+		role := p.auth.login(remote, r.PostFormValue("secret"))
+		if role == ROLE_NONE {
+			slog.Warn("login failed", "remote", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			renderTemplate(w, "header", nil)
+			renderTemplate(w, "login", &Data{LoginFailed: true})
+			return
+		}
+		token, err := p.auth.sessions.create(role)
+		if err != nil {
+			// the session is valid until the restart nevertheless
+			slog.Error("persisting sessions failed", "err", err)
+		}
+		slog.Info("login", "remote", r.RemoteAddr, "role", role)
+		http.SetCookie(w, &http.Cookie{
+			Name:     SESSION_COOKIE,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(SESSION_LIFETIME.Seconds()),
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "only GET and POST supported")
+	}
+}
+
+func (p *PlayerHandlerPassthrough) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "only POST supported")
+		return
+	}
+	if cookie, err := r.Cookie(SESSION_COOKIE); err == nil && p.auth != nil {
+		err = p.auth.sessions.delete(cookie.Value)
+		if err != nil {
+			slog.Error("persisting sessions failed", "err", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: SESSION_COOKIE, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// checkOrigin accepts requests (e.g. websocket connections) of pages served
+// by the Player itself, i.e. the Origin's host has to match the requested
+// host. Requests without Origin are not sent by browsers and thus accepted.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	slog.Warn("reject cross origin request", "path", r.URL.Path, "origin", origin, "host", r.Host)
+	return false
+}
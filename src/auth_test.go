@@ -0,0 +1,147 @@
+package godible
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuth(t *testing.T) {
+	p := newPlayerHandlerPassthrough(newLibraryTestPlayer(t, "a/1.wav"))
+	sessionsPath := filepath.Join(t.TempDir(), "sessions.json")
+	var err error
+	p.auth, err = newAuth("geheim", "1234", sessionsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.auth.failureDelay = 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.requireRole(ROLE_REMOTE, p.rootHandler))
+	mux.HandleFunc("/login", p.loginHandler)
+	mux.HandleFunc("/logout", p.logoutHandler)
+	p.registerApi(mux)
+
+	request := func(method string, path string, body string, cookie *http.Cookie, expectedStatus int) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if path == "/login" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, r)
+		if recorder.Code != expectedStatus {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, expectedStatus, recorder.Code, recorder.Body)
+		}
+		return recorder
+	}
+	login := func(secret string) *http.Cookie {
+		t.Helper()
+		recorder := request("POST", "/login", "secret="+url.QueryEscape(secret), nil, http.StatusSeeOther)
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == SESSION_COOKIE {
+				return cookie
+			}
+		}
+		t.Fatalf("expected a session cookie")
+		return nil
+	}
+
+	request("GET", API_PREFIX+"/state", "", nil, http.StatusUnauthorized)
+	if location := request("GET", "/", "", nil, http.StatusSeeOther).Header().Get("Location"); location != "/login" {
+		t.Errorf("expected a redirect to the login page, got %q", location)
+	}
+	if body := request("POST", "/login", "secret=0000", nil, http.StatusUnauthorized).Body.String(); !strings.Contains(body, "Falsches Passwort") {
+		t.Errorf("expected the login page to report the failure")
+	}
+
+	remote := login("1234")
+	if body := request("GET", "/", "", remote, http.StatusOK).Body.String(); !strings.Contains(body, `data-role="remote"`) {
+		t.Errorf("expected the web interface to hide the admin controls")
+	}
+	request("GET", API_PREFIX+"/state", "", remote, http.StatusOK)
+	request("POST", API_PREFIX+"/volume", `{"volume": 40}`, remote, http.StatusOK)
+	request("POST", API_PREFIX+"/commands/repeatmode", `{"payload": "directory"}`, remote, http.StatusForbidden)
+	request("POST", API_PREFIX+"/commands/sleeptimer", `{"payload": "60"}`, remote, http.StatusForbidden)
+	request("PUT", API_PREFIX+"/rfid/1234", `{"directory": "a"}`, remote, http.StatusForbidden)
+	p.handleCommand(ROLE_REMOTE, WebsocketApiRequest{Type: "repeatmode", Payload: string(REPEAT_DIRECTORY)})
+	if p.getSettings().RepeatMode == REPEAT_DIRECTORY {
+		t.Errorf("expected the websocket command to be forbidden")
+	}
+
+	admin := login("geheim")
+	request("POST", API_PREFIX+"/commands/repeatmode", `{"payload": "directory"}`, admin, http.StatusOK)
+
+	// the sessions survive a restart
+	sessions, err := loadSessionStore(sessionsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions.role(remote.Value) != ROLE_REMOTE || sessions.role(admin.Value) != ROLE_ADMIN {
+		t.Errorf("expected the sessions to be persisted")
+	}
+
+	request("POST", "/logout", "", remote, http.StatusSeeOther)
+	request("GET", API_PREFIX+"/state", "", remote, http.StatusUnauthorized)
+	request("GET", API_PREFIX+"/state", "", admin, http.StatusOK)
+}
+
+func TestLoginDelay(t *testing.T) {
+	a, err := newAuth("geheim", "1234", filepath.Join(t.TempDir(), "sessions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.failureDelay = 200 * time.Millisecond
+	start := time.Now()
+	if role := a.login("10.0.0.1", "0000"); role != ROLE_NONE {
+		t.Errorf("expected a failed login, got %v", role)
+	}
+	// a failed login does not delay the logins of other addresses
+	if role := a.login("10.0.0.2", "1234"); role != ROLE_REMOTE {
+		t.Errorf("expected a remote login, got %v", role)
+	}
+	if elapsed := time.Since(start); elapsed >= a.failureDelay {
+		t.Errorf("expected the logins to be undelayed, took %s", elapsed)
+	}
+	// but the next login of the failed address
+	if role := a.login("10.0.0.1", "geheim"); role != ROLE_ADMIN {
+		t.Errorf("expected an admin login, got %v", role)
+	}
+	if elapsed := time.Since(start); elapsed < a.failureDelay {
+		t.Errorf("expected the login after a failure to be delayed, took %s", elapsed)
+	}
+	// a successful login is not delayed any more
+	start = time.Now()
+	a.login("10.0.0.1", "geheim")
+	if elapsed := time.Since(start); elapsed >= a.failureDelay {
+		t.Errorf("expected the login after a success to be undelayed, took %s", elapsed)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for _, test := range []struct {
+		origin   string
+		expected bool
+	}{
+		{"", true},
+		{"http://godible:1234", true},
+		{"https://GODIBLE:1234", true},
+		{"http://godible", false},
+		{"http://evil.example:1234", false},
+		{"null", false},
+	} {
+		r := httptest.NewRequest("GET", "http://godible:1234/ws", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if checkOrigin(r) != test.expected {
+			t.Errorf("checkOrigin(%q): expected %t", test.origin, test.expected)
+		}
+	}
+}
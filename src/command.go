@@ -0,0 +1,173 @@
+package godible
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The errors of commands are wrapping these errors, so that the REST API can
+// map them to HTTP status codes.
+var (
+	errInvalidArgument = errors.New("invalid argument")
+	errNotFound        = errors.New("not found")
+	errConflict        = errors.New("conflict")
+	errUnknownCommand  = errors.New("unknown command")
+)
+
+// invalidPayload wraps the error of parsing a command's payload.
+func invalidPayload(name string, err error) error {
+	return fmt.Errorf("%w: payload of %s: %s", errInvalidArgument, name, err)
+}
+
+// remoteCommands are the commands a ROLE_REMOTE user may run, i.e. the ones
+// controlling the playback. The others (changing the settings, the library
+// or the RFID mappings) require ROLE_ADMIN.
+var remoteCommands = map[string]bool{
+	"toggle":       true,
+	"play":         true,
+	"pause":        true,
+	"next":         true,
+	"previous":     true,
+	"seek":         true,
+	"seekrelative": true,
+	"volume":       true,
+	"volumeup":     true,
+	"volumedown":   true,
+}
+
+// commandRole returns the role required to run the command name.
+func commandRole(name string) Role {
+	if remoteCommands[name] {
+		return ROLE_REMOTE
+	}
+	return ROLE_ADMIN
+}
+
+// runCommand executes the command name with its (command specific) payload.
+// It is the command layer shared by the websocket and the REST API.
+func (p *PlayerHandlerPassthrough) runCommand(name string, payload string) error {
+	switch name {
+	case "toggle":
+		p.Command(TOGGLE)
+	case "play":
+		p.Command(PLAY)
+	case "pause":
+		p.Command(PAUSE)
+	case "next":
+		p.Command(NEXT)
+	case "previous":
+		p.Command(PREVIOUS)
+	case "seek":
+		// the payload is the offset from the current track's beginning
+		// in seconds
+		seconds, err := strconv.Atoi(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		p.Seek(time.Duration(seconds) * time.Second)
+	case "seekrelative":
+		// the payload is the number of seconds to move forward
+		// (positive) or backward (negative)
+		seconds, err := strconv.Atoi(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		p.CommandValue(SEEK_RELATIVE, seconds)
+	case "volume":
+		volume, err := strconv.Atoi(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		p.CommandValue(SET_VOLUME, volume)
+	case "volumeup":
+		p.Command(VOLUME_UP)
+	case "volumedown":
+		p.Command(VOLUME_DOWN)
+	case "maxvolume":
+		maxVolume, err := strconv.Atoi(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		return p.SetMaxVolume(maxVolume)
+	case "sleeptimer":
+		// the payload is either the number of minutes (0 cancels the
+		// sleep timer) or "track" for the end of the current track
+		if payload == "track" {
+			p.SetSleepTimerEndOfTrack()
+			return nil
+		}
+		minutes, err := strconv.Atoi(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		p.SetSleepTimer(time.Duration(minutes) * time.Minute)
+	case "sortorder":
+		return p.SetSortOrder(SortOrder(payload))
+	case "directoryorder":
+		return p.SetDirectoryOrder(DirectoryOrder(payload))
+	case "repeatmode":
+		return p.SetRepeatMode(RepeatMode(payload))
+	case "shuffle":
+		// the payload is "true" or "false"
+		shuffle, err := strconv.ParseBool(payload)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		return p.SetShuffle(shuffle)
+	case "delete":
+		// the payload is a track's or a directory's path
+		return p.DeletePath(payload)
+	case "rename":
+		// the payload is a JSON object of the track's or directory's
+		// path and its new name
+		var rename struct {
+			Path string `json:"path"`
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal([]byte(payload), &rename)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		return p.RenamePath(rename.Path, rename.Name)
+	case "move":
+		// the payload is a JSON object of the track's or directory's
+		// path and the target directory relative to the data directory
+		var move struct {
+			Path      string `json:"path"`
+			Directory string `json:"directory"`
+		}
+		err := json.Unmarshal([]byte(payload), &move)
+		if err != nil {
+			return invalidPayload(name, err)
+		}
+		return p.MovePath(move.Path, move.Directory)
+	case "rescan":
+		return p.Rescan()
+	case "rfidtracklearn":
+		// the payload is either a track's or a directory's path
+		directory := ""
+		track := p.findTrack(payload)
+		if track == nil {
+			directory = payload
+			track = p.findDirectoryTrack(directory)
+		}
+		if track == nil {
+			return fmt.Errorf("%w: track or directory %q", errNotFound, payload)
+		}
+		if !p.rtm.SetTrackTrainer(track, directory) {
+			return fmt.Errorf("%w: TrackTrainer already set", errConflict)
+		}
+	case "rfidbookmarkreset":
+		if !p.ResetBookmark(payload) {
+			return fmt.Errorf("%w: rfid uid %q", errNotFound, payload)
+		}
+	case "rfidtracklearnstop":
+		p.rtm.StopTrackTrainer()
+	default:
+		return fmt.Errorf("%w: %q", errUnknownCommand, name)
+	}
+	return nil
+}
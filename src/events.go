@@ -0,0 +1,276 @@
+package godible
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// EVENT_STATE_PERIOD is the period the Player's state (e.g. the
+	// position of the current Track) is checked for changes in
+	EVENT_STATE_PERIOD = time.Second
+	// EVENT_ROWS_PERIOD is the period the rows are checked for changes in,
+	// which were not notified (see Player.notify)
+	EVENT_ROWS_PERIOD = 10 * time.Second
+	// EVENT_QUEUE_SIZE is the number of events a subscriber may lag
+	// behind; slower subscribers are dropped
+	EVENT_QUEUE_SIZE = 64
+)
+
+// eventBus distributes the events of the Player (e.g. changes of its state
+// or its TrackList) to its subscribers, e.g. websocket connections. The
+// events are WebsocketApiRequests, so that they can be sent as they are.
+type eventBus struct {
+	mutex       sync.Mutex
+	subscribers map[*subscription]bool
+	// snapshot are the events describing the current state completely,
+	// which a new subscriber starts with
+	snapshot []WebsocketApiRequest
+	// changed signals a (possible) change to the publisher
+	changed chan struct{}
+}
+
+// subscription receives the events of an eventBus. Its channel is closed, if
+// the subscriber was dropped for lagging behind.
+type subscription struct {
+	events chan WebsocketApiRequest
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		subscribers: make(map[*subscription]bool),
+		changed:     make(chan struct{}, 1),
+	}
+}
+
+// subscribe returns a new subscription and the snapshot to start with; the
+// subscription receives all events published after the snapshot.
+func (bus *eventBus) subscribe() (*subscription, []WebsocketApiRequest) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	sub := &subscription{events: make(chan WebsocketApiRequest, EVENT_QUEUE_SIZE)}
+	bus.subscribers[sub] = true
+	return sub, slices.Clone(bus.snapshot)
+}
+
+func (bus *eventBus) unsubscribe(sub *subscription) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	if bus.subscribers[sub] {
+		delete(bus.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publish replaces the snapshot and sends the events, which lead from the
+// previous snapshot to the new one, to all subscribers.
+func (bus *eventBus) publish(snapshot []WebsocketApiRequest, events ...WebsocketApiRequest) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.snapshot = snapshot
+	for sub := range bus.subscribers {
+		for _, event := range events {
+			select {
+			case sub.events <- event:
+				continue
+			default:
+			}
+			slog.Warn("event subscriber lags behind, drop it")
+			delete(bus.subscribers, sub)
+			close(sub.events)
+			break
+		}
+	}
+}
+
+// notify signals a (possible) change of the Player's state or TrackList, so
+// that it is published right away.
+func (player *Player) notify() {
+	if player.events == nil {
+		return
+	}
+	select {
+	case player.events.changed <- struct{}{}:
+	default:
+	}
+}
+
+// PositionEvent is the payload of the "position" event, which is published
+// instead of the whole state, if only the current Track's position changed.
+type PositionEvent struct {
+	Position        int64 `json:"position"`
+	DurationCurrent int64 `json:"duration_current"`
+	// Current is the fullpath_hash_sum of the current Track's row
+	Current string `json:"current"`
+}
+
+// RowsDiffEvent is the payload of the "rows_diff" event, which updates the
+// rows of the previous "rows" (or "rows_diff") event.
+type RowsDiffEvent struct {
+	// Changed are the added and changed rows
+	Changed []Row `json:"changed"`
+	// Removed are the fullpath_hash_sums of the removed rows
+	Removed []string `json:"removed"`
+	// Order are the fullpath_hash_sums of all rows in their new order;
+	// it is omitted, if the order did not change
+	Order []string `json:"order,omitempty"`
+}
+
+// publisher publishes the changes of the Player's state and rows on the
+// Player's eventBus. The changes are detected centrally, so that the costs
+// do not multiply with the number of subscribers.
+type publisher struct {
+	p         *PlayerHandlerPassthrough
+	state     HttpState
+	stateJson []byte
+	rows      []Row
+	rowsJson  []byte
+}
+
+// runPublisher publishes the changes of the Player's state and rows; it does
+// not return.
+func (p *PlayerHandlerPassthrough) runPublisher() {
+	pub := &publisher{p: p}
+	pub.publish(pub.stateEvents(), pub.rowsEvents())
+
+	stateTicker := time.NewTicker(EVENT_STATE_PERIOD)
+	defer stateTicker.Stop()
+	rowsTicker := time.NewTicker(EVENT_ROWS_PERIOD)
+	defer rowsTicker.Stop()
+	for {
+		select {
+		case <-p.events.changed:
+			pub.publish(pub.stateEvents(), pub.rowsEvents())
+		case <-stateTicker.C:
+			pub.publish(pub.stateEvents(), nil)
+		case <-rowsTicker.C:
+			pub.publish(nil, pub.rowsEvents())
+		}
+	}
+}
+
+func (pub *publisher) publish(stateEvents []WebsocketApiRequest, rowsEvents []WebsocketApiRequest) {
+	events := append(stateEvents, rowsEvents...)
+	if len(events) == 0 {
+		return
+	}
+	snapshot := []WebsocketApiRequest{
+		{Type: "state", Payload: string(pub.stateJson)},
+		{Type: "rows", Payload: string(pub.rowsJson)},
+	}
+	pub.p.events.publish(snapshot, events...)
+}
+
+func marshalEvent(eventType string, payload any) WebsocketApiRequest {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("marshalling event failed", "type", eventType, "err", err)
+	}
+	return WebsocketApiRequest{Type: eventType, Payload: string(data)}
+}
+
+// stateEvents updates the published state and returns the events of its
+// changes: a "position" event, if only the position changed, otherwise a
+// "state" event.
+func (pub *publisher) stateEvents() []WebsocketApiRequest {
+	state := *pub.p.state()
+	stateJson, err := json.Marshal(state)
+	if err != nil {
+		slog.Error("marshalling state failed", "err", err)
+		return nil
+	}
+	if bytes.Equal(stateJson, pub.stateJson) {
+		return nil
+	}
+	positionOnly := pub.stateJson != nil
+	if positionOnly {
+		previous := state
+		previous.Position = pub.state.Position
+		previous.DurationCurrent = pub.state.DurationCurrent
+		previousJson, _ := json.Marshal(previous)
+		positionOnly = bytes.Equal(previousJson, pub.stateJson)
+	}
+	pub.state = state
+	pub.stateJson = stateJson
+	if !positionOnly {
+		return []WebsocketApiRequest{{Type: "state", Payload: string(stateJson)}}
+	}
+	position := PositionEvent{
+		Position:        state.Position,
+		DurationCurrent: state.DurationCurrent,
+	}
+	if current := pub.p.getCurrent(); current != nil {
+		position.Current = fmt.Sprintf("%x", sha1.Sum([]byte(current.Path)))
+	}
+	return []WebsocketApiRequest{marshalEvent("position", position)}
+}
+
+// rowsEvents updates the published rows and returns a "rows_diff" event of
+// their changes (a "rows" event of all rows initially).
+func (pub *publisher) rowsEvents() []WebsocketApiRequest {
+	rows := pub.p.trackListToRows()
+	event := "rows_diff"
+	var diff RowsDiffEvent
+	if pub.rowsJson == nil {
+		event = "rows"
+	} else {
+		var changed bool
+		diff, changed = diffRows(pub.rows, rows)
+		if !changed {
+			return nil
+		}
+	}
+	rowsJson, err := json.Marshal(rows)
+	if err != nil {
+		slog.Error("marshalling rows failed", "err", err)
+		return nil
+	}
+	pub.rows = rows
+	pub.rowsJson = rowsJson
+	if event == "rows" {
+		return []WebsocketApiRequest{{Type: event, Payload: string(rowsJson)}}
+	}
+	return []WebsocketApiRequest{marshalEvent(event, diff)}
+}
+
+// diffRows returns the difference between the rows old and new, and whether
+// there is any.
+func diffRows(old []Row, new []Row) (RowsDiffEvent, bool) {
+	diff := RowsDiffEvent{Changed: []Row{}, Removed: []string{}}
+	hashSums := make(map[string]string, len(old))
+	for _, row := range old {
+		hashSums[row.FullpathHashSum] = row.HashSum
+	}
+	orderChanged := len(old) != len(new)
+	for i, row := range new {
+		hashSum, ok := hashSums[row.FullpathHashSum]
+		if !ok || hashSum != row.HashSum {
+			diff.Changed = append(diff.Changed, row)
+		}
+		delete(hashSums, row.FullpathHashSum)
+		if !orderChanged && old[i].FullpathHashSum != row.FullpathHashSum {
+			orderChanged = true
+		}
+	}
+	for _, row := range old {
+		if _, ok := hashSums[row.FullpathHashSum]; ok {
+			diff.Removed = append(diff.Removed, row.FullpathHashSum)
+		}
+	}
+	if orderChanged {
+		diff.Order = make([]string, len(new))
+		for i, row := range new {
+			diff.Order[i] = row.FullpathHashSum
+		}
+	}
+	return diff, orderChanged || len(diff.Changed) > 0
+}
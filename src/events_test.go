@@ -0,0 +1,111 @@
+package godible
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDiffRows(t *testing.T) {
+	old := []Row{
+		{FullpathHashSum: "a", HashSum: "1"},
+		{FullpathHashSum: "b", HashSum: "1"},
+		{FullpathHashSum: "c", HashSum: "1"},
+	}
+	if _, changed := diffRows(old, slices.Clone(old)); changed {
+		t.Errorf("expected no changes")
+	}
+
+	diff, changed := diffRows(old, []Row{
+		{FullpathHashSum: "a", HashSum: "1"},
+		{FullpathHashSum: "c", HashSum: "2"},
+	})
+	if !changed || len(diff.Changed) != 1 || diff.Changed[0].FullpathHashSum != "c" {
+		t.Errorf("expected c to be changed, got %+v", diff)
+	}
+	if !slices.Equal(diff.Removed, []string{"b"}) || !slices.Equal(diff.Order, []string{"a", "c"}) {
+		t.Errorf("expected b to be removed, got %+v", diff)
+	}
+
+	diff, _ = diffRows(old, []Row{old[1], old[0], old[2]})
+	if len(diff.Changed) != 0 || !slices.Equal(diff.Order, []string{"b", "a", "c"}) {
+		t.Errorf("expected only the order to change, got %+v", diff)
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	bus := newEventBus()
+	snapshot := []WebsocketApiRequest{{Type: "state", Payload: "{}"}}
+	bus.publish(snapshot)
+
+	sub, received := bus.subscribe()
+	if !slices.Equal(received, snapshot) {
+		t.Errorf("expected the snapshot, got %v", received)
+	}
+	event := WebsocketApiRequest{Type: "position", Payload: "{}"}
+	bus.publish(snapshot, event)
+	if received := <-sub.events; received != event {
+		t.Errorf("expected %v, got %v", event, received)
+	}
+
+	// a lagging subscriber is dropped
+	for range EVENT_QUEUE_SIZE + 1 {
+		bus.publish(snapshot, event)
+	}
+	for range sub.events {
+	}
+	if len(bus.subscribers) != 0 {
+		t.Errorf("expected the lagging subscriber to be dropped")
+	}
+	bus.unsubscribe(sub)
+}
+
+func TestWebsocketSnapshotAndDiff(t *testing.T) {
+	p := newPlayerHandlerPassthrough(newLibraryTestPlayer(t, "a/1.wav", "b/1.wav"))
+	go p.runPublisher()
+	server := httptest.NewServer(http.HandlerFunc(p.wsHandler))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	read := func() WebsocketApiRequest {
+		t.Helper()
+		var event WebsocketApiRequest
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		err := conn.ReadJSON(&event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	// the snapshot may be sent before the publisher published it
+	event := read()
+	for event.Type != "rows" {
+		event = read()
+	}
+	var rows []Row
+	err = json.Unmarshal([]byte(event.Payload), &rows)
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("expected a snapshot of 2 rows, got %s (%v)", event.Payload, err)
+	}
+
+	p.removeTracks(filepath.Join(p.dataDir, "b"))
+	for event.Type != "rows_diff" {
+		event = read()
+	}
+	var diff RowsDiffEvent
+	err = json.Unmarshal([]byte(event.Payload), &diff)
+	if err != nil || len(diff.Removed) != 1 || diff.Removed[0] != rows[1].FullpathHashSum {
+		t.Errorf("expected a diff removing the second row, got %s (%v)", event.Payload, err)
+	}
+}
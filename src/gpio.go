@@ -13,6 +13,10 @@ import (
 
 type pinfunction func()
 
+// pinHoldFunction is called repeatedly while a button is held, getting the
+// time the button is held so far.
+type pinHoldFunction func(held time.Duration)
+
 // initHostDrivers initialises all the relevant host drivers.
 //
 // It is safe to call this function multiple times, as the underlying function
@@ -25,6 +29,8 @@ func initHostDrivers() error {
 const (
 	TICK_PERIOD                = time.Millisecond * 15
 	LONG_BUTTON_PRESS_DURATION = time.Millisecond * 1500
+	HOLD_BUTTON_PRESS_DURATION = time.Millisecond * 500
+	HOLD_REPEAT_PERIOD         = time.Millisecond * 250
 )
 
 func getPinCurrentFunction(pinIO gpio.PinIO) error {
@@ -57,44 +63,74 @@ func setupPinByGPIOName(gpioName string) (gpio.PinIO, error) {
 	return pinIO, nil
 }
 
-func callFuncOnPinEdgeAndPoll(pinIO gpio.PinIO, fnShort pinfunction, fnLong pinfunction) {
+// pinHandler holds the functions called on a button's presses. Functions
+// may be nil.
+type pinHandler struct {
+	// short is called, if the button is released before longDuration
+	short pinfunction
+	// long is called once, as soon as the button is held for longDuration
+	long         pinfunction
+	longDuration time.Duration
+	// held is called every HOLD_REPEAT_PERIOD while the button is held
+	// longer than longDuration, passing the total time being held
+	held pinHoldFunction
+	// release is called, if the button is released after longDuration
+	release pinfunction
+}
+
+// pollPress polls a pressed button via read until it is released and calls
+// the respective functions of handler.
+func pollPress(read func() bool, handler pinHandler) {
+	// XXX: `deref ticker.Stop()` not needed:
+	// [...] As of Go 1.23, the garbage collector can recover
+	// unreferenced tickers even if they haven't been stopped.
+	ticker := time.NewTicker(TICK_PERIOD)
+
+	pressed := time.Now()
+	long_triggered := false
+	var lastHeld time.Time
+	for now := range ticker.C {
+		if !read() {
+			if !long_triggered && handler.short != nil {
+				slog.Debug("trigger short pinfunction")
+				handler.short()
+			}
+			if long_triggered && handler.release != nil {
+				slog.Debug("trigger release pinfunction")
+				handler.release()
+			}
+			return
+		}
+		held := now.Sub(pressed)
+		if held <= handler.longDuration {
+			continue
+		}
+		if !long_triggered {
+			long_triggered = true
+			if handler.long != nil {
+				slog.Debug("trigger long pinfunction")
+				handler.long()
+			}
+		}
+		if handler.held != nil && now.Sub(lastHeld) >= HOLD_REPEAT_PERIOD {
+			lastHeld = now
+			handler.held(held)
+		}
+	}
+}
+
+func callFuncOnPinEdgeAndPoll(pinIO gpio.PinIO, handler pinHandler) {
 	for {
 		edgeDetected := pinIO.WaitForEdge(0)
 		if !edgeDetected {
 			slog.Error("this should not have happen ...")
 			continue
 		}
-
-		// XXX: `deref ticker.Stop()` not needed:
-		// [...] As of Go 1.23, the garbage collector can recover
-		// unreferenced tickers even if they haven't been stopped.
-		ticker := time.NewTicker(TICK_PERIOD)
-
-		counter := 1
-		long_triggered := false
-		for range ticker.C {
-			if pinIO.Read() {
-				if long_triggered {
-					continue
-				}
-				counter = counter + 1
-				if counter*int(TICK_PERIOD) > int(LONG_BUTTON_PRESS_DURATION) {
-					slog.Debug("trigger long pinfunction")
-					fnLong()
-					long_triggered = true
-				}
-			} else {
-				if !long_triggered {
-					slog.Debug("trigger short pinfunction")
-					fnShort()
-				}
-				break
-			}
-		}
+		pollPress(func() bool { return bool(pinIO.Read()) }, handler)
 	}
 }
 
-func RegisterPinFunc(gpioName string, fnShort pinfunction, fnLong pinfunction) error {
+func registerPinHandler(gpioName string, handler pinHandler) error {
 	pinIO, err := setupPinByGPIOName(gpioName)
 	if err != nil {
 		return err
@@ -105,6 +141,28 @@ func RegisterPinFunc(gpioName string, fnShort pinfunction, fnLong pinfunction) e
 		return fmt.Errorf("gpio: could not gather current function for pin '%s'", pinIO.Name())
 	}
 
-	go callFuncOnPinEdgeAndPoll(pinIO, fnShort, fnLong)
+	go callFuncOnPinEdgeAndPoll(pinIO, handler)
 	return nil
 }
+
+// RegisterPinFunc calls fnShort on a short button press and fnLong once the
+// button is held for LONG_BUTTON_PRESS_DURATION.
+func RegisterPinFunc(gpioName string, fnShort pinfunction, fnLong pinfunction) error {
+	return registerPinHandler(gpioName, pinHandler{
+		short:        fnShort,
+		long:         fnLong,
+		longDuration: LONG_BUTTON_PRESS_DURATION,
+	})
+}
+
+// RegisterPinHoldFunc calls fnShort on a short button press. Once the button
+// is held for HOLD_BUTTON_PRESS_DURATION, fnHeld is called repeatedly until
+// the button is released, which calls fnRelease.
+func RegisterPinHoldFunc(gpioName string, fnShort pinfunction, fnHeld pinHoldFunction, fnRelease pinfunction) error {
+	return registerPinHandler(gpioName, pinHandler{
+		short:        fnShort,
+		longDuration: HOLD_BUTTON_PRESS_DURATION,
+		held:         fnHeld,
+		release:      fnRelease,
+	})
+}
@@ -0,0 +1,50 @@
+package godible
+
+import (
+	"testing"
+	"time"
+)
+
+// pressFor returns a read function of a button pressed for the given
+// duration.
+func pressFor(duration time.Duration) func() bool {
+	released := time.Now().Add(duration)
+	return func() bool {
+		return time.Now().Before(released)
+	}
+}
+
+func TestPollPressShort(t *testing.T) {
+	var short, held, release int
+	pollPress(pressFor(100*time.Millisecond), pinHandler{
+		short:        func() { short++ },
+		longDuration: HOLD_BUTTON_PRESS_DURATION,
+		held:         func(time.Duration) { held++ },
+		release:      func() { release++ },
+	})
+	if short != 1 || held != 0 || release != 0 {
+		t.Errorf("expected only the short function to be called, got short %d, held %d, release %d", short, held, release)
+	}
+}
+
+func TestPollPressHeld(t *testing.T) {
+	var short, release int
+	var held []time.Duration
+	pollPress(pressFor(HOLD_BUTTON_PRESS_DURATION+3*HOLD_REPEAT_PERIOD+HOLD_REPEAT_PERIOD/2), pinHandler{
+		short:        func() { short++ },
+		longDuration: HOLD_BUTTON_PRESS_DURATION,
+		held:         func(d time.Duration) { held = append(held, d) },
+		release:      func() { release++ },
+	})
+	if short != 0 || release != 1 {
+		t.Errorf("expected only the release function to be called, got short %d, release %d", short, release)
+	}
+	if len(held) != 4 {
+		t.Fatalf("expected the held function to be called 4 times, got %d", len(held))
+	}
+	for i := 1; i < len(held); i++ {
+		if held[i] <= held[i-1] || held[i-1] <= HOLD_BUTTON_PRESS_DURATION {
+			t.Errorf("expected increasing held durations above %s, got %v", HOLD_BUTTON_PRESS_DURATION, held)
+		}
+	}
+}
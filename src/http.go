@@ -1,14 +1,13 @@
 package godible
 
 import (
-	"bytes"
 	"crypto/sha1"
+	"crypto/tls"
 	"embed"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"strconv"
 	"text/template"
 	"time"
 
@@ -18,14 +17,27 @@ import (
 //go:embed assets/*
 var assetsFS embed.FS
 
-var playerWebGuiPort = 1234
+// HTTP_LISTEN_DEFAULT is the default address of the web interface
+const HTTP_LISTEN_DEFAULT = "0.0.0.0:1234"
+
+// HttpConfig configures the listeners of the web interface.
+type HttpConfig struct {
+	// Listen is the address of the web interface; with TLS enabled, it
+	// redirects to TlsListen
+	Listen string
+	// TlsListen is the address of the HTTPS web interface, which uses a
+	// self-signed certificate (see loadOrCreateCertificate); TLS is
+	// disabled, if it is empty
+	TlsListen string
+	// AdminPassword enables the authentication (see auth); it logs in
+	// with ROLE_ADMIN
+	AdminPassword string
+	// RemotePin optionally logs in with ROLE_REMOTE
+	RemotePin string
+}
 
 var upgrader = websocket.Upgrader{
-	// XXX: Currently, CheckOrigin in Upgrader allows all connections.
-	// TODO: Check r.Host or r.Header[Origin]?
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: checkOrigin,
 }
 
 type Row struct {
@@ -35,10 +47,13 @@ type Row struct {
 	DirnameShow     string `json:"dirname_show"`
 	DirnameHashSum  string `json:"dirname_hash_sum"`
 	DirnameFull     string `json:"dirname_full"`
+	DirnameRfidUid  string `json:"dirname_rfid_uid"`
 	CurrentSeconds  int64  `json:"current_seconds"`
 	DurationSeconds int64  `json:"duration_seconds"`
 	RfidUid         string `json:"rfid_uid"`
 	HashSum         string `json:"hash_sum"`
+	// the Track's tags are flattened into the Row's JSON object
+	Tags
 }
 
 func (row *Row) setHashSum() error {
@@ -55,6 +70,20 @@ func (row *Row) setHashSum() error {
 
 type PlayerHandlerPassthrough struct {
 	*Player
+	// hub tracks the websocket connections
+	hub *wsHub
+	// auth authenticates the users; nil disables the authentication
+	auth *auth
+}
+
+func newPlayerHandlerPassthrough(p *Player) *PlayerHandlerPassthrough {
+	if p.events == nil {
+		p.events = newEventBus()
+	}
+	return &PlayerHandlerPassthrough{
+		Player: p,
+		hub:    newWsHub(p.events, p.notify),
+	}
 }
 
 func (p *PlayerHandlerPassthrough) trackToRow(track *Track) Row {
@@ -65,9 +94,11 @@ func (p *PlayerHandlerPassthrough) trackToRow(track *Track) Row {
 		DirnameShow:     track.DirnameShow(),
 		DirnameHashSum:  fmt.Sprintf("%x", sha1.Sum([]byte(track.DirnameFull()))),
 		DirnameFull:     track.DirnameFull(),
+		DirnameRfidUid:  p.rtm.GetDirectoryUid(track.DirnameFull()),
 		CurrentSeconds:  track.CurrentSeconds(),
-		DurationSeconds: track.duration,
+		DurationSeconds: track.DurationSeconds(),
 		RfidUid:         p.rtm.GetUid(track),
+		Tags:            track.Tags(),
 	}
 	err := row.setHashSum()
 	if err != nil {
@@ -77,22 +108,16 @@ func (p *PlayerHandlerPassthrough) trackToRow(track *Track) Row {
 }
 
 func (p *PlayerHandlerPassthrough) trackListToRows() []Row {
-	ret := make([]Row, p.TrackList.Len())
-
-	element := p.TrackList.Front()
-	if element == nil {
+	tracks := p.tracks()
+	if len(tracks) == 0 {
+		// an empty table is sent nevertheless, as all tracks may
+		// have been removed
 		slog.Error("failed to transform tracklist into gui rows: no tracks found")
-		return nil
 	}
 
-	for i := range ret {
-		track, ok := element.Value.(*Track)
-		if !ok {
-			slog.Error("expected value of type Track", "track", track)
-			continue
-		}
+	ret := make([]Row, len(tracks))
+	for i, track := range tracks {
 		ret[i] = p.trackToRow(track)
-		element = element.Next()
 	}
 	return ret
 }
@@ -104,6 +129,12 @@ type Tbody struct {
 
 type Data struct {
 	Tbodies []Tbody
+	// Role is the user's role; the web interface hides the controls the
+	// user may not use
+	Role Role
+	// Auth is set, if the authentication is enabled
+	Auth        bool
+	LoginFailed bool
 }
 
 func renderTemplate(w http.ResponseWriter, filename string, data *Data) {
@@ -120,7 +151,7 @@ func renderTemplate(w http.ResponseWriter, filename string, data *Data) {
 
 func (p *PlayerHandlerPassthrough) rootHandler(w http.ResponseWriter, r *http.Request) {
 	renderTemplate(w, "header", nil)
-	renderTemplate(w, "body", nil)
+	renderTemplate(w, "body", &Data{Role: p.role(r), Auth: p.auth != nil})
 }
 
 type WebsocketApiRequest struct {
@@ -134,177 +165,159 @@ type RfidTrackTraining struct {
 }
 
 type HttpState struct {
-	IsPlaying         bool              `json:"is_playing"`
-	Name              string            `json:"name"`
-	Position          int64             `json:"position"`
-	Length            int64             `json:"length"`
-	Duration          int64             `json:"duration"`
-	DurationCurrent   int64             `json:"duration_current"`
-	RfidTrackTraining RfidTrackTraining `json:"rfid_track_training"`
+	IsPlaying bool   `json:"is_playing"`
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	// Tags are the current Track's tags
+	Tags Tags `json:"tags"`
+	// Position is the offset from the current Track's beginning in
+	// milliseconds
+	Position        int64 `json:"position"`
+	Duration        int64 `json:"duration"`
+	DurationCurrent int64 `json:"duration_current"`
+	Volume          int   `json:"volume"`
+	MaxVolume       int   `json:"max_volume"`
+	// SleepTimer is the number of seconds left until the playback is
+	// paused; zero if unset
+	SleepTimer           int64             `json:"sleep_timer"`
+	SleepTimerEndOfTrack bool              `json:"sleep_timer_end_of_track"`
+	SortOrder            SortOrder         `json:"sort_order"`
+	DirectoryOrder       DirectoryOrder    `json:"directory_order"`
+	RepeatMode           RepeatMode        `json:"repeat_mode"`
+	Shuffle              bool              `json:"shuffle"`
+	RfidTrackTraining    RfidTrackTraining `json:"rfid_track_training"`
+	Rescan               RescanStatus      `json:"rescan"`
+	// Clients is the number of connected websocket clients
+	Clients int `json:"clients"`
 }
 
 func (p *PlayerHandlerPassthrough) state() *HttpState {
-	ret := &HttpState{IsPlaying: p.playing}
+	settings := p.getSettings()
+	ret := &HttpState{
+		IsPlaying:      p.isPlaying(),
+		Volume:         p.Volume(),
+		MaxVolume:      settings.MaxVolume,
+		SortOrder:      settings.SortOrder,
+		DirectoryOrder: settings.DirectoryOrder,
+		RepeatMode:     settings.RepeatMode,
+		Shuffle:        settings.Shuffle,
+		Rescan:         p.RescanStatus(),
+		Clients:        p.hub.count(),
+	}
 	current := p.getCurrent()
 	if current != nil {
 		ret.Name = current.Basename()
-		ret.Position = current.position
-		ret.Length = current.length
-		ret.Duration = current.duration
-		ret.DurationCurrent = int64(0)
-		if ret.Length > 0 {
-			var tmp float64 = float64(ret.Position) / float64(ret.Length)
-			tmp = tmp * float64(ret.Duration)
-			ret.DurationCurrent = int64(tmp)
-		}
+		ret.Tags = current.Tags()
+		ret.Position = current.position.Milliseconds()
+		ret.Duration = current.DurationSeconds()
+		ret.DurationCurrent = current.CurrentSeconds()
 	}
-	// TODO: handle directory case;
-	if p.rtm.TrackTrainer != nil {
-		ret.RfidTrackTraining.Name = p.rtm.TrackTrainer.Track.Basename()
-		ret.RfidTrackTraining.TimeLeft = p.rtm.TrackTrainer.TimeLeft
+	sleepTimer, endOfTrack := p.SleepTimer()
+	ret.SleepTimer = int64(sleepTimer.Round(time.Second).Seconds())
+	ret.SleepTimerEndOfTrack = endOfTrack
+	if scope := p.getScope(); scope != "" {
+		ret.Scope = dirnameShow(scope)
+	}
+	if p.rtm != nil {
+		ret.RfidTrackTraining.Name, ret.RfidTrackTraining.TimeLeft = p.rtm.TrackTraining()
 	}
 	return ret
 }
 
-func (p *PlayerHandlerPassthrough) handleCommand(req WebsocketApiRequest) {
-	switch req.Type {
-	case "toggle":
-		p.Command(TOGGLE)
-	case "next":
-		p.Command(NEXT)
-	case "previous":
-		p.Command(PREVIOUS)
-	case "slide":
-		duration_current_to_set, err := strconv.Atoi(req.Payload)
-		if err != nil {
-			slog.Error("handleCommand 'slide' can not convert payload to integer", "err", err)
-			return
-		}
-
-		if p.playing {
-			p.Command(TOGGLE)
-			//FIXME: replace sleep synchronizing the cancelfunc (as in: toggle is prohibited if a cancelfunc is running)
-			time.Sleep(50 * time.Millisecond)
-		}
-
-		track := p.getCurrent()
-		length := track.length
-		duration := track.duration
-
-		var position int64
-		position = 0
-		if duration > 0 {
-			div := float64(duration_current_to_set) / float64(duration)
-			position = int64(div * float64(length))
-			position = position - (position % 4)
-		}
-
-		track.SetPosition(position)
-		p.Command(TOGGLE)
-	case "rfidtracklearn":
-		// TODO payload is directory: extend the TrackTrainer struct
-		track := p.findTrack(req.Payload)
-		if track == nil {
-			slog.Error("handleCommand rfidtracklearn: could not find respective track", "payload", req.Payload)
-			return
-		}
-		if p.rtm.SetTrackTrainer(track) == false {
-			slog.Error("handleCommand rfidtracklearn: TrackTrainer already set", "track", track)
-			return
-		}
-	case "rfidtracklearnstop":
-		// FIXME: this is racy: see state() above
-		// TODO: create mutex in RfidTrackManager/TrackTrainer and access/modify only via mutex-protected functions
-		p.rtm.TrackTrainer = nil
-	default:
-		slog.Error("unknown WebsocketApiRequest type", "type", req.Type)
+// handleCommand executes a command received via websocket from a user of
+// role; see runCommand.
+func (p *PlayerHandlerPassthrough) handleCommand(role Role, req WebsocketApiRequest) {
+	err := authorize(role, commandRole(req.Type))
+	if err == nil {
+		err = p.runCommand(req.Type, req.Payload)
+		p.notify()
 	}
-}
-
-func (p *PlayerHandlerPassthrough) wsReader(conn *websocket.Conn) {
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			slog.Error("wsReader err", "err", err)
-			break
-		}
-
-		decoder := json.NewDecoder(bytes.NewReader(message))
-		var req WebsocketApiRequest
-		err = decoder.Decode(&req)
-		if err != nil {
-			slog.Error("failed to decode message as WebsocketApiRequest", "message", message, "err", err)
-			continue
-		}
-		p.handleCommand(req)
+	if err != nil {
+		slog.Error("handleCommand failed", "type", req.Type, "payload", req.Payload, "err", err)
 	}
 }
 
-func (p *PlayerHandlerPassthrough) wsWriteState(conn *websocket.Conn) bool {
-	jsonstate, _ := json.Marshal(p.state())
-	req, _ := json.Marshal(WebsocketApiRequest{
-		Type:    "state",
-		Payload: string(jsonstate),
-	})
-	err := conn.WriteMessage(websocket.TextMessage, req)
-	if err != nil {
-		slog.Error("writing state via websocket connection failed", "req", req, "err", err)
-		return false
+func (p *PlayerHandlerPassthrough) wsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "only GET and POST supported")
+		return
 	}
-	return true
-}
 
-func (p *PlayerHandlerPassthrough) wsWriteRows(conn *websocket.Conn) bool {
-	jsonrows, _ := json.Marshal(p.trackListToRows())
-	req, _ := json.Marshal(WebsocketApiRequest{
-		Type:    "rows",
-		Payload: string(jsonrows),
-	})
-	err := conn.WriteMessage(websocket.TextMessage, req)
+	connection, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		slog.Error("writing rows via websocket connection failed", "req", req, "err", err)
-		return false
+		slog.Error("ws upgrade err", "err", err)
+		return
 	}
-	return true
+	client := p.hub.register(connection)
+	go client.writePump()
+	client.readPump(func(req WebsocketApiRequest) {
+		// the role is looked up for each command, so that a logout
+		// takes effect on open connections as well
+		p.handleCommand(p.role(r), req)
+	})
 }
 
-func (p *PlayerHandlerPassthrough) wsWriter(conn *websocket.Conn) {
-	// Time allowed to write the message to the client.
-	writeWait := 600 * time.Millisecond
-	// Send messages to peer with this period. Must be less than writeWait.
-	sendPeriod := 500 * time.Millisecond
+// uploadHandler stores uploaded audio files (and zip archives of folders)
+// within DATADIR; see receiveUpload. The library watcher adds them to the
+// TrackList.
+func (p *PlayerHandlerPassthrough) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "only POST supported")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
 
-	sendTicker := time.NewTicker(sendPeriod)
+	r.Body = http.MaxBytesReader(w, r.Body, UPLOAD_MAX_SIZE)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(UploadResult{Error: err.Error()})
+		return
+	}
+	err = beginPermWrite()
+	if err != nil {
+		slog.Error("upload: remounting /perm writable failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		encoder.Encode(UploadResult{Error: err.Error()})
+		return
+	}
 	defer func() {
-		sendTicker.Stop()
-		conn.Close()
+		err := endPermWrite()
+		if err != nil {
+			slog.Error("upload: remounting /perm read-only failed", "err", err)
+		}
 	}()
 
-	for range sendTicker.C {
-		conn.SetWriteDeadline(time.Now().Add(writeWait))
-		if !p.wsWriteState(conn) || !p.wsWriteRows(conn) {
-			slog.Error("abort (broken?) wsWriter routine due to erros")
-			return
-		}
+	result, err := receiveUpload(DATADIR, reader)
+	if err != nil {
+		slog.Error("upload failed", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(UploadResult{Error: err.Error()})
+		return
 	}
+	encoder.Encode(result)
 }
 
-func (p *PlayerHandlerPassthrough) wsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
+// rescanHandler starts a rescan of the library (see Player.Rescan) and
+// responds with its RescanStatus. The progress is also part of the state
+// sent via websocket.
+func (p *PlayerHandlerPassthrough) rescanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		fmt.Fprintf(w, "only GET and POST supported")
+		fmt.Fprintf(w, "only POST supported")
 		return
 	}
-
-	connection, err := upgrader.Upgrade(w, r, nil)
+	w.Header().Set("Content-Type", "application/json")
+	err := p.Rescan()
 	if err != nil {
-		slog.Error("ws upgrade err", "err", err)
-		return
+		w.WriteHeader(http.StatusConflict)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
 	}
-	defer connection.Close()
-
-	go p.wsWriter(connection)
-	p.wsReader(connection)
+	json.NewEncoder(w).Encode(p.RescanStatus())
 }
 
 func assetsFileServer(w http.ResponseWriter, r *http.Request) {
@@ -318,20 +331,56 @@ func assetsFileServer(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func InitHttpHandlers(p *Player) error {
+func InitHttpHandlers(p *Player, config HttpConfig) error {
 	http.HandleFunc("/css/", assetsFileServer)
 	http.HandleFunc("/img/", assetsFileServer)
 	http.HandleFunc("/js/", assetsFileServer)
 	http.HandleFunc("/fonts/", assetsFileServer)
-	phPassthrough := &PlayerHandlerPassthrough{p}
-	http.HandleFunc("/", phPassthrough.rootHandler)
-	http.HandleFunc("/ws", phPassthrough.wsHandler)
+	phPassthrough := newPlayerHandlerPassthrough(p)
+	if config.AdminPassword != "" || config.RemotePin != "" {
+		var err error
+		phPassthrough.auth, err = newAuth(config.AdminPassword, config.RemotePin, SESSIONS_FILE)
+		if err != nil {
+			return err
+		}
+	}
+	go phPassthrough.runPublisher()
+	http.HandleFunc("/", phPassthrough.requireRole(ROLE_REMOTE, phPassthrough.rootHandler))
+	http.HandleFunc("/login", phPassthrough.loginHandler)
+	http.HandleFunc("/logout", phPassthrough.logoutHandler)
+	http.HandleFunc("/ws", phPassthrough.requireRole(ROLE_REMOTE, phPassthrough.wsHandler))
+	http.HandleFunc("/upload", apiSameOrigin(phPassthrough.requireRole(ROLE_ADMIN, phPassthrough.uploadHandler)))
+	http.HandleFunc("/rescan", apiSameOrigin(phPassthrough.requireRole(ROLE_ADMIN, phPassthrough.rescanHandler)))
+	phPassthrough.registerApi(http.DefaultServeMux)
+
+	if config.TlsListen == "" {
+		go func() {
+			slog.Info("listen on ", "address", config.Listen)
+			err := http.ListenAndServe(config.Listen, nil)
+			slog.Error("ListenAndServe failed", "address", config.Listen, "error", err)
+		}()
+		return nil
+	}
 
+	cert, err := loadOrCreateCertificate(TLS_CERT_FILE, TLS_KEY_FILE)
+	if err != nil {
+		return fmt.Errorf("loading tls certificate failed: %w", err)
+	}
+	server := &http.Server{
+		Addr:      config.TlsListen,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
 	go func() {
-		address := fmt.Sprintf("0.0.0.0:%d", playerWebGuiPort)
-		slog.Info("listen on ", "address", address)
-		err := http.ListenAndServe(address, nil)
-		slog.Error("ListenAndServe failed", "address", address, "error", err)
+		slog.Info("listen on ", "address", config.TlsListen, "tls", true)
+		err := server.ListenAndServeTLS("", "")
+		slog.Error("ListenAndServeTLS failed", "address", config.TlsListen, "error", err)
 	}()
+	if config.Listen != "" {
+		go func() {
+			slog.Info("redirect to https", "address", config.Listen)
+			err := http.ListenAndServe(config.Listen, httpsRedirectHandler(config.TlsListen))
+			slog.Error("ListenAndServe failed", "address", config.Listen, "error", err)
+		}()
+	}
 	return nil
 }
@@ -1,7 +1,6 @@
 package godible
 
 import (
-	"container/list"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,16 +8,14 @@ import (
 )
 
 func TestInitHttpHandlers(t *testing.T) {
-	p := &Player{}
-	tracklist := list.New()
+	p := newTestPlayer(t)
 	// FIXME: CreateTrackList takes forever ... TODO: speed up
 	os.MkdirAll("/tmp/empty", 0o755)
-	err := CreateTrackList(tracklist, "/tmp/empty")
+	err := CreateTrackList(p.TrackList, "/tmp/empty")
 	if err != nil {
 		t.Fatalf("CreateTrackList failed: %+v", err)
 	}
-	p.TrackList = tracklist
-	err = InitHttpHandlers(p)
+	err = InitHttpHandlers(p, HttpConfig{Listen: HTTP_LISTEN_DEFAULT})
 	if err != nil {
 		t.Fatalf("InitHttpHandlers failed: %+v", err)
 	}
@@ -0,0 +1,248 @@
+package godible
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// withinPath reports whether path is the file or directory dir, or located
+// within the directory dir.
+func withinPath(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// movedPath returns the new path of path after src has been moved to dst;
+// path has to be within src (see withinPath).
+func movedPath(path string, src string, dst string) string {
+	return dst + strings.TrimPrefix(path, src)
+}
+
+// libraryPath validates a path of a file or directory within root, given
+// either absolute or relative to root. It fails for root itself, for hidden
+// paths and for paths leading outside of root, also via symbolic links, as
+// well as for missing files.
+func libraryPath(root string, path string) (string, error) {
+	root = filepath.Clean(root)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || hasHiddenComponent(rel) {
+		return "", fmt.Errorf("%w: path %q", errInvalidArgument, path)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", errNotFound, path)
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	if !withinPath(realDir, realRoot) {
+		return "", fmt.Errorf("%w: path %q leads outside of %s", errInvalidArgument, path, root)
+	}
+	return path, nil
+}
+
+// validName reports whether name can be used as a file or directory name.
+func validName(name string) bool {
+	return name != "" && !strings.Contains(name, "/") && !strings.HasPrefix(name, ".")
+}
+
+// leave moves Player.current away from the Tracks within path to the next
+// remaining Track (nil, if there is none). A scope within path is reset. It
+// returns false, if the current Track is not within path.
+func (player *Player) leave(path string) bool {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	if player.current == nil {
+		return false
+	}
+	current, _ := player.current.Value.(*Track)
+	if current == nil || !withinPath(current.Path, path) {
+		return false
+	}
+	if player.scope != "" && withinPath(player.scope, path) {
+		player.scope = ""
+	}
+	player.current, _ = player.orderedStep(false, func(element *list.Element) bool {
+		track, _ := element.Value.(*Track)
+		return track != nil && !withinPath(track.Path, path) && player.inScope(element)
+	})
+	return true
+}
+
+// DeletePath deletes the file or directory at path (see libraryPath) and
+// removes its Tracks and RFID mappings. If the current Track is deleted, the
+// Player continues with the next remaining Track.
+func (player *Player) DeletePath(path string) error {
+	path, err := libraryPath(player.dataDir, path)
+	if err != nil {
+		return err
+	}
+
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	if isOnPerm(path) {
+		err = beginPermWrite()
+		if err != nil {
+			return err
+		}
+		defer endPermWrite()
+	}
+	wasPlaying := player.isPlaying()
+	if player.leave(path) && wasPlaying {
+		player.resetCancel(cancelReasonNext)
+		if player.getCurrent() != nil {
+			player.sendPlaySignal()
+		}
+	}
+	err = os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+	slog.Info("deleted", "path", path)
+	player.removeTracks(path)
+	player.rtm.dropUnresolved(path)
+	player.saveStateAsync()
+	return nil
+}
+
+// RenamePath renames the file or directory at path (see libraryPath) to
+// name, keeping its Tracks' state and RFID mappings.
+func (player *Player) RenamePath(path string, name string) error {
+	path, err := libraryPath(player.dataDir, path)
+	if err != nil {
+		return err
+	}
+	if !validName(name) {
+		return fmt.Errorf("%w: name %q", errInvalidArgument, name)
+	}
+	return player.movePath(path, filepath.Join(filepath.Dir(path), name))
+}
+
+// MovePath moves the file or directory at path (see libraryPath) into the
+// directory given relative to the Player's data directory, keeping its
+// Tracks' state and RFID mappings. Missing directories are created.
+func (player *Player) MovePath(path string, directory string) error {
+	path, err := libraryPath(player.dataDir, path)
+	if err != nil {
+		return err
+	}
+	dir, err := dataPath(player.dataDir, directory)
+	if err != nil {
+		return err
+	}
+	return player.movePath(path, filepath.Join(dir, filepath.Base(path)))
+}
+
+// movePath renames src to dst and updates the TrackList, the RFID mappings
+// and the TrackIndex accordingly. A playing current Track is paused during
+// the rename and continued afterwards.
+func (player *Player) movePath(src string, dst string) error {
+	if src == dst {
+		return nil
+	}
+	if withinPath(dst, src) {
+		return fmt.Errorf("%w: can not move %s into itself", errInvalidArgument, src)
+	}
+
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	// like the source (see libraryPath), the destination must not lead
+	// outside of the data directory via symbolic links
+	err := confinePath(player.dataDir, dst)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%w: already exists: %s", errConflict, dst)
+	}
+
+	if isOnPerm(src) {
+		err := beginPermWrite()
+		if err != nil {
+			return err
+		}
+		defer endPermWrite()
+	}
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	// the current Track is replaced, hence it must not be played meanwhile
+	resume := false
+	if current := player.getCurrent(); current != nil && withinPath(current.Path, src) && player.isPlaying() {
+		player.doToggle()
+		player.waitStopped()
+		resume = true
+	}
+	err = renameNoReplace(src, dst)
+	if errors.Is(err, fs.ErrExist) {
+		err = fmt.Errorf("%w: already exists: %s", errConflict, dst)
+	}
+	if err == nil {
+		slog.Info("moved", "src", src, "dst", dst)
+		player.moveTracks(src, dst)
+	}
+	if resume {
+		player.doToggle()
+	}
+	return err
+}
+
+// waitStopped waits (for a limited time) until the Play goroutine stopped
+// playing.
+func (player *Player) waitStopped() {
+	for range 100 {
+		if !player.isPlaying() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	slog.Error("playback did not stop in time")
+}
+
+// moveTracks replaces the Tracks within src by Tracks of the respective
+// paths within dst, which keep the original Tracks' state.
+func (player *Player) moveTracks(src string, dst string) {
+	moved := make(map[*Track]*Track)
+
+	player.currentMutex.Lock()
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		track, _ := element.Value.(*Track)
+		if track == nil || !withinPath(track.Path, src) {
+			continue
+		}
+		renamed := *track
+		renamed.Path = movedPath(track.Path, src, dst)
+		element.Value = &renamed
+		moved[track] = &renamed
+	}
+	if player.scope != "" && withinPath(player.scope, src) {
+		player.scope = movedPath(player.scope, src, dst)
+	}
+	player.currentMutex.Unlock()
+
+	player.sortTrackList()
+	player.rtm.moveTracks(moved, src, dst)
+	if player.trackIndex != nil {
+		player.trackIndex.rename(src, dst)
+	}
+	player.saveStateAsync()
+	player.notify()
+}
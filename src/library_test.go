@@ -0,0 +1,146 @@
+package godible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibraryPath(t *testing.T) {
+	root := t.TempDir()
+	err := os.Mkdir(filepath.Join(root, "books"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	err = os.Symlink(outside, filepath.Join(root, "outside"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{filepath.Join(root, "books"), outside} {
+		err = os.WriteFile(filepath.Join(dir, "momo.mp3"), nil, 0640)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"books/momo.mp3", filepath.Join(root, "books")} {
+		if _, err := libraryPath(root, path); err != nil {
+			t.Errorf("libraryPath(%q): unexpected error: %s", path, err)
+		}
+	}
+	for _, path := range []string{"", root, "..", "../etc/passwd", "/etc/passwd", ".upload-1", "books/.hidden", "books/missing.mp3", "outside/momo.mp3"} {
+		if _, err := libraryPath(root, path); err == nil {
+			t.Errorf("libraryPath(%q): expected an error", path)
+		}
+	}
+}
+
+// newLibraryTestPlayer creates a Player of the wav files at the given paths
+// relative to a new data directory.
+func newLibraryTestPlayer(t *testing.T, paths ...string) *Player {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	for _, path := range paths {
+		path = filepath.Join(dataDir, path)
+		err := os.MkdirAll(filepath.Dir(path), 0750)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeWavFile(t, path, 44100, make([]byte, 4*44100))
+	}
+	p := newTestPlayer(t)
+	p.dataDir = dataDir
+	p.trackIndex = LoadTrackIndex(filepath.Join(dir, "tracks.json"))
+	p.settingsPath = filepath.Join(dir, "settings.json")
+	err := CreateIndexedTrackList(p.TrackList, dataDir, p.trackIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestDeletePath(t *testing.T) {
+	p := newLibraryTestPlayer(t, "a/1.wav", "a/2.wav", "b/1.wav")
+	p.setCurrent(p.findTrack(filepath.Join(p.dataDir, "a", "2.wav")))
+	p.setScope(filepath.Join(p.dataDir, "a"))
+
+	err := p.DeletePath("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(p.dataDir, "a")); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be deleted, got %v", err)
+	}
+	tracks := p.tracks()
+	if len(tracks) != 1 || tracks[0].Path != filepath.Join(p.dataDir, "b", "1.wav") {
+		t.Errorf("expected only b/1.wav to remain, got %v", tracks)
+	}
+	if current := p.getCurrent(); current != tracks[0] {
+		t.Errorf("expected the current track to move to the remaining track, got %s", current)
+	}
+	if scope := p.getScope(); scope != "" {
+		t.Errorf("expected the scope to be reset, got %s", scope)
+	}
+}
+
+func TestRenamePath(t *testing.T) {
+	p := newLibraryTestPlayer(t, "a/1.wav", "a/2.wav", "b/1.wav")
+	original := p.findTrack(filepath.Join(p.dataDir, "a", "2.wav"))
+	original.SetPosition(500000000)
+	p.setCurrent(original)
+	p.rtm.UidTrackMap["dir"] = &TrackMapping{Track: original, Directory: filepath.Join(p.dataDir, "a")}
+
+	err := p.RenamePath("a", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamedPath := filepath.Join(p.dataDir, "c", "2.wav")
+	if _, err := os.Stat(renamedPath); err != nil {
+		t.Errorf("expected the directory to be renamed: %s", err)
+	}
+	expected := []string{
+		filepath.Join(p.dataDir, "b", "1.wav"),
+		filepath.Join(p.dataDir, "c", "1.wav"),
+		renamedPath,
+	}
+	tracks := p.tracks()
+	for i, track := range tracks {
+		if i >= len(expected) || track.Path != expected[i] {
+			t.Fatalf("expected tracks %v, got %v", expected, tracks)
+		}
+	}
+	current := p.getCurrent()
+	if current == nil || current.Path != renamedPath || current.position != original.position {
+		t.Errorf("expected the current track to be renamed keeping its position, got %s", current)
+	}
+	mapping, ok := p.rtm.GetMapping("dir")
+	if !ok || mapping.Track != current || mapping.Directory != filepath.Join(p.dataDir, "c") {
+		t.Errorf("expected the rfid mapping to follow the rename, got %+v", mapping)
+	}
+
+	err = p.MovePath(filepath.Join(p.dataDir, "b", "1.wav"), "c")
+	if err == nil {
+		t.Errorf("expected moving onto an existing file to fail")
+	}
+	err = p.RenamePath("c", "../b")
+	if err == nil {
+		t.Errorf("expected an invalid name to fail")
+	}
+
+	// symbolic links must not lead the destination outside of the data
+	// directory
+	outside := t.TempDir()
+	err = os.Symlink(outside, filepath.Join(p.dataDir, "outside"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, directory := range []string{"outside", "outside/c"} {
+		err = p.MovePath("b", directory)
+		if err == nil {
+			t.Errorf("expected moving into %s to fail", directory)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing to be moved outside of the data directory, got %v", entries)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"github.com/h2non/filetype"
 	mp3 "github.com/hajimehoshi/go-mp3"
 	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
 )
 
 type AudioFileFormat int
@@ -16,6 +18,7 @@ const (
 	WAV AudioFileFormat = iota
 	MP3
 	OGG
+	FLAC
 	UNKNOWN
 )
 
@@ -24,6 +27,7 @@ type Metadata struct {
 	bytesPerSample int
 	sampleRate     int
 	channelNum     int
+	tags           Tags
 }
 
 func wavMetadata(f *os.File) (*Metadata, error) {
@@ -38,10 +42,15 @@ func wavMetadata(f *os.File) (*Metadata, error) {
 		bytesPerSample: int(d.SampleBitDepth() / 8),
 		sampleRate:     int(d.SampleRate),
 		channelNum:     int(d.NumChans),
+		tags:           wavTags(f),
 	}, nil
 }
 
 func mp3Metadata(f *os.File) (*Metadata, error) {
+	fileinfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
 	dec, err := mp3.NewDecoder(f)
 	if err != nil {
 		return nil, err
@@ -54,6 +63,7 @@ func mp3Metadata(f *os.File) (*Metadata, error) {
 		// (little endian) 2 channels even if the source is single
 		// channel MP3.
 		channelNum: 2,
+		tags:       id3Tags(f, fileinfo.Size()),
 	}, nil
 }
 
@@ -67,6 +77,33 @@ func oggMetadata(f *os.File) (*Metadata, error) {
 		bytesPerSample: 2, // enforce 2, as the bitdepth is a feature of uncompressed audio
 		sampleRate:     int(dec.SampleRate()),
 		channelNum:     dec.Channels(),
+		tags:           vorbisCommentTags(dec.CommentHeader().Comments),
+	}, nil
+}
+
+func flacMetadata(f *os.File) (*Metadata, error) {
+	// in contrast to flac.New, flac.Parse keeps the metadata blocks
+	stream, err := flac.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	var comments []string
+	for _, block := range stream.Blocks {
+		comment, ok := block.Body.(*meta.VorbisComment)
+		if !ok {
+			continue
+		}
+		for _, tag := range comment.Tags {
+			comments = append(comments, tag[0]+"="+tag[1])
+		}
+	}
+	return &Metadata{
+		audioFormat: FLAC,
+		// FlacReader aligns the samples to 2 or 3 bytes
+		bytesPerSample: flacBytesPerSample(stream.Info.BitsPerSample),
+		sampleRate:     int(stream.Info.SampleRate),
+		channelNum:     int(stream.Info.NChannels),
+		tags:           vorbisCommentTags(comments),
 	}, nil
 }
 
@@ -75,6 +112,7 @@ func detectAudioFileFormat(path string) (AudioFileFormat, error) {
 	if err != nil {
 		return UNKNOWN, err
 	}
+	defer f.Close()
 	// only first 261 bytes representing the max file header is required
 	head := make([]byte, 261)
 	_, err = f.Read(head)
@@ -89,6 +127,8 @@ func detectAudioFileFormat(path string) (AudioFileFormat, error) {
 		return WAV, nil
 	case "ogg":
 		return OGG, nil
+	case "flac":
+		return FLAC, nil
 	default:
 		return UNKNOWN, fmt.Errorf("unsupported file format: %s", kind.Extension)
 	}
@@ -110,6 +150,8 @@ func NewMetadata(path string) (*Metadata, error) {
 		return mp3Metadata(f)
 	case OGG:
 		return oggMetadata(f)
+	case FLAC:
+		return flacMetadata(f)
 	default:
 		return wavMetadata(f)
 
@@ -6,10 +6,10 @@ import (
 	"errors"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/anisse/alsa"
 )
 
 type CommandVal int
@@ -18,6 +18,22 @@ const (
 	TOGGLE CommandVal = iota
 	NEXT
 	PREVIOUS
+	VOLUME_UP
+	VOLUME_DOWN
+	// SET_VOLUME takes the volume in percent as value
+	SET_VOLUME
+	// PAUSE pauses the playback; in contrast to TOGGLE, it does nothing if
+	// the Player is already paused
+	PAUSE
+	// SEEK_RELATIVE takes the seconds to move the current Track's position
+	// by as value; negative values rewind
+	SEEK_RELATIVE
+	// CYCLE_REPEAT_MODE switches to the next RepeatMode
+	CYCLE_REPEAT_MODE
+	TOGGLE_SHUFFLE
+	// PLAY starts the playback; in contrast to TOGGLE, it does nothing if
+	// the Player is already playing
+	PLAY
 )
 
 const DATADIR = "/perm/godible-data/"
@@ -27,79 +43,261 @@ type Player struct {
 	// to one command
 	commandMutex sync.Mutex
 	// currentMutex is needed as both the Command functions as well as the
-	// Play goroutine simultaneously access Player.current
+	// Play goroutine simultaneously access Player.current. It also
+	// protects the TrackList, which is modified by the libraryWatcher.
 	currentMutex sync.Mutex
-	// TrackList represents the files located in DATADIR. Currently, it is
-	// only created in NewPlayer and never updated.
-	TrackList       *list.List
+	// TrackList represents the files located in dataDir. It is created in
+	// NewPlayer and kept up to date by the libraryWatcher.
+	TrackList *list.List
+	dataDir   string
+	// trackIndex caches the probed metadata of the TrackList's files
+	trackIndex      *TrackIndex
 	ctx             context.Context
 	cancelCauseFunc context.CancelCauseFunc
 	// current is currently played (or paused) Track
 	current *list.Element
+	// scope restricts the playback to the Tracks of this directory (e.g.
+	// after reading a directory's RFID UID). Empty means no restriction.
+	scope string
+	// activeUid is the RFID UID whose mapping is currently played; its
+	// bookmark follows the playback
+	activeUid string
 	// playSignal is used to signal Player to play the Player.current
 	playSignal chan bool
 	// playing represents Player's state of playing or pausing
 	playing bool
 	// maintain a mapping of RFID UIDs and Track
 	rtm *RfidTrackManager
+	// stateMutex serializes saving the Player's state into statePath
+	stateMutex sync.Mutex
+	statePath  string
+	// savedState is the last state written to (or read from) statePath
+	savedState []byte
+	// sink is the output of the played Tracks
+	sink AudioSink
+	// sinkFormat is the format sink is opened with; nil if it is closed
+	sinkFormat *AudioFormat
+	// volume is the current volume in percent; it is read for every
+	// written buffer, hence atomic
+	volume        atomic.Int32
+	settingsMutex sync.Mutex
+	settings      Settings
+	settingsPath  string
+	sleepTimer    sleepTimer
+	rescan        libraryRescan
+	// events publishes the changes of the Player's state and TrackList
+	events *eventBus
+	// fadeOut attenuates the volume (in percent) while the sleep timer
+	// fades out the playback
+	fadeOut atomic.Int32
+	// seekMutex protects pendingSeek and the transitions of playing, so
+	// that a seek is either applied by the Play goroutine or directly to
+	// the paused Track
+	seekMutex   sync.Mutex
+	pendingSeek *pendingSeek
+	// scrubbing is true while a button is held to scrub through the
+	// current Track; scrubResume is whether to play after scrubbing
+	scrubbing   bool
+	scrubResume bool
+}
+
+// pendingSeek is a seek of the played Track, which is applied by the Play
+// goroutine before reading further PCM data.
+type pendingSeek struct {
+	track    *Track
+	position time.Duration
 }
 
 var cancelReasonNext = errors.New("next")
 var cancelReasonPrevious = errors.New("previous")
 var cancelReasonPause = errors.New("pause")
+var cancelReasonShutdown = errors.New("shutdown")
 
-func NewPlayer() (*Player, error) {
+func NewPlayer(sink AudioSink) (*Player, error) {
 	trackList := list.New()
+	player := &Player{
+		sink:         sink,
+		TrackList:    trackList,
+		dataDir:      DATADIR,
+		trackIndex:   LoadTrackIndex(TRACKS_FILE),
+		current:      trackList.Front(),
+		playSignal:   make(chan bool),
+		rtm:          newRfidTrackManager(RFID_MAPPINGS_FILE),
+		statePath:    STATE_FILE,
+		settingsPath: SETTINGS_FILE,
+		events:       newEventBus(),
+	}
+	settings, err := loadSettings(player.settingsPath)
+	if err != nil {
+		slog.Error("loading settings failed, use defaults", "path", player.settingsPath, "err", err)
+	}
+	player.settings = settings
+	player.setVolume(DEFAULT_VOLUME)
 
 	// XXX: NewTrack takes almost 1s for a 50mb MP3 file.
-	//      For faster startup, create the tracklist in parallel.
+	//      For faster startup, create the tracklist in parallel and
+	//      only probe files which are not (or outdated) in the index.
 	go func() {
-		err := CreateTrackList(trackList, DATADIR)
+		idx := player.trackIndex
+		scanned := list.New()
+		err := CreateIndexedTrackList(scanned, player.dataDir, idx)
 		if err != nil {
 			slog.Error("CreateTrackList failed", "err", err)
 			os.Exit(1)
 		}
+		player.currentMutex.Lock()
+		trackList.PushBackList(scanned)
+		player.currentMutex.Unlock()
+		player.sortTrackList()
+		idx.prune()
+		err = idx.Save()
+		if err != nil {
+			slog.Error("saving track index failed", "path", TRACKS_FILE, "err", err)
+		}
+		// the persisted mappings refer to tracks by path, hence they
+		// can only be resolved after the tracklist is complete
+		err = player.rtm.load(player.findTrack, player.findDirectoryTrack)
+		if err != nil {
+			slog.Error("loading rfid mappings failed", "path", RFID_MAPPINGS_FILE, "err", err)
+		}
+		playing, err := player.loadState()
+		if err != nil {
+			slog.Error("loading player state failed", "path", player.statePath, "err", err)
+		}
+		go player.runStateSaver()
+		err = player.watchLibrary(player.dataDir, idx)
+		if err != nil {
+			slog.Error("watching the library failed, changes require a restart", "path", player.dataDir, "err", err)
+		}
+		if playing {
+			player.Command(TOGGLE)
+		}
 	}()
-	return &Player{
-		TrackList:  trackList,
-		current:    trackList.Front(),
-		playSignal: make(chan bool),
-		rtm:        newRfidTrackManager(),
-	}, nil
+	return player, nil
 }
 
-func (player *Player) findTrackElement(track *Track) *list.Element {
-	element := player.TrackList.Front()
-	for element != nil {
-		trackIterate, _ := element.Value.(*Track)
-		if trackIterate == nil {
-			slog.Error("findTrackElement: the Tracklist's element stored an invalid Track (this should not happen)")
+// tracks returns the Tracks of the TrackList, in the TrackList's order.
+func (player *Player) tracks() []*Track {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	tracks := make([]*Track, 0, player.TrackList.Len())
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		track, _ := element.Value.(*Track)
+		if track == nil {
+			slog.Error("tracks: the Tracklist's element stored an invalid Track (this should not happen)")
 			continue
 		}
-		if trackIterate == track {
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+// findTrackElement returns the TrackList's element of the given Track. The
+// caller has to hold currentMutex.
+func (player *Player) findTrackElement(track *Track) *list.Element {
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		if element.Value == track {
 			return element
 		}
-		element = element.Next()
 	}
 	return nil
 }
 
+// findTrack returns the Track of the given path. Paths persisted by former
+// versions contain duplicate slashes, hence the path is cleaned.
 func (player *Player) findTrack(trackPath string) *Track {
-	element := player.TrackList.Front()
-	for element != nil {
-		track, _ := element.Value.(*Track)
-		if track == nil {
-			slog.Error("findTrack: the Tracklist's element stored an invalid Track (this should not happen)")
-			continue
-		}
+	trackPath = filepath.Clean(trackPath)
+	for _, track := range player.tracks() {
 		if track.Path == trackPath {
 			return track
 		}
-		element = element.Next()
 	}
 	return nil
 }
 
+// findDirectoryTrack returns the first Track located in the given directory.
+func (player *Player) findDirectoryTrack(directory string) *Track {
+	for _, track := range player.tracks() {
+		if track.DirnameFull() == directory {
+			return track
+		}
+	}
+	return nil
+}
+
+func (player *Player) getScope() string {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	return player.scope
+}
+
+func (player *Player) setScope(directory string) {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	player.scope = directory
+}
+
+func (player *Player) getActiveUid() string {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	return player.activeUid
+}
+
+func (player *Player) setActiveUid(uid string) {
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	player.activeUid = uid
+}
+
+// inScope reports whether the element's Track is part of the Player's scope.
+// The caller has to hold currentMutex.
+func (player *Player) inScope(element *list.Element) bool {
+	if player.scope == "" {
+		return true
+	}
+	track, _ := element.Value.(*Track)
+	return track != nil && track.DirnameFull() == player.scope
+}
+
+// updateBookmark bookmarks the current Track and its position for the
+// active RFID UID.
+func (player *Player) updateBookmark() {
+	current := player.getCurrent()
+	if current == nil {
+		return
+	}
+	player.rtm.setBookmark(player.getActiveUid(), current, current.position)
+}
+
+// saveBookmark bookmarks the current Track like updateBookmark and persists
+// the changed bookmarks.
+func (player *Player) saveBookmark() {
+	player.updateBookmark()
+	err := player.rtm.saveBookmarks()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", player.rtm.path, "err", err)
+	}
+}
+
+// ResetBookmark resets the bookmark of the given RFID UID to the beginning
+// of its mapping. It returns false, if there is no mapping for the RFID UID.
+func (player *Player) ResetBookmark(uid string) bool {
+	if !player.rtm.resetBookmark(uid, player.findDirectoryTrack) {
+		return false
+	}
+	// stop following the playback, otherwise the bookmark would be
+	// overwritten right away
+	if player.getActiveUid() == uid {
+		player.setActiveUid("")
+	}
+	return true
+}
+
 func (player *Player) getCurrent() *Track {
 	var track *Track
 
@@ -124,74 +322,291 @@ func (player *Player) setCurrent(track *Track) {
 	player.current = element
 }
 
-func (player *Player) setCurrentPrevious() {
-	player.currentMutex.Lock()
-	defer player.currentMutex.Unlock()
-
-	if player.current != nil {
-		player.current = player.current.Prev()
+// setCurrentStep moves Player.current to the previous (or next) element
+// within the Player's scope, in the order given by settings. With a RepeatMode
+// per directory, it stays within the current Track's directory. It returns
+// true, if it wrapped around at the borders. If the scope does not contain
+// any Track (anymore), it is reset. The caller has to hold currentMutex.
+func (player *Player) setCurrentStep(previous bool, settings Settings) bool {
+	directory := ""
+	if player.current != nil && settings.RepeatMode.perDirectory() {
+		if current, _ := player.current.Value.(*Track); current != nil {
+			directory = current.DirnameFull()
+		}
+	}
+	inRange := func(element *list.Element) bool {
+		track, _ := element.Value.(*Track)
+		return player.inScope(element) && track != nil && (directory == "" || track.DirnameFull() == directory)
+	}
+	var element *list.Element
+	var wrapped bool
+	if settings.Shuffle {
+		element, wrapped = player.shuffleStep(previous, settings.ShuffleSeed, inRange)
+	} else {
+		element, wrapped = player.orderedStep(previous, inRange)
+	}
+	if element != nil {
+		player.current = element
+		return wrapped
+	}
+	if player.scope != "" {
+		slog.Error("no track found within scope, reset scope", "scope", player.scope)
+		player.scope = ""
 	}
 	if player.current == nil {
-		player.current = player.TrackList.Back()
+		player.current = player.TrackList.Front()
 	}
+	return true
 }
 
-func (player *Player) setCurrentNext() {
+func (player *Player) setCurrentPrevious() bool {
+	settings := player.getSettings()
+
 	player.currentMutex.Lock()
 	defer player.currentMutex.Unlock()
 
-	if player.current != nil {
-		player.current = player.current.Next()
+	return player.setCurrentStep(true, settings)
+}
+
+func (player *Player) setCurrentNext() bool {
+	settings := player.getSettings()
+
+	player.currentMutex.Lock()
+	defer player.currentMutex.Unlock()
+
+	return player.setCurrentStep(false, settings)
+}
+
+// sampleRateSupported reports whether a Track's sample rate can be converted
+// to the outputFormat's sample rate.
+func sampleRateSupported(sampleRate int) bool {
+	return sampleRate >= 8000 && sampleRate <= 192000
+}
+
+// openSink (re)opens the Player's sink, if it is not yet opened with the
+// given format.
+func (player *Player) openSink(format AudioFormat) error {
+	if player.sinkFormat != nil && *player.sinkFormat == format {
+		return nil
 	}
-	if player.current == nil {
-		player.current = player.TrackList.Front()
+	err := player.closeSink()
+	if err != nil {
+		slog.Error("closing audio sink failed", "err", err)
+	}
+	err = player.sink.Open(format)
+	if err != nil {
+		return err
 	}
+	player.sinkFormat = &format
+	return nil
 }
 
-func sampleRateSupported(sampleRate int) bool {
-	switch sampleRate {
-	case 44100:
-		return true
-	case 48000:
-		return true
+// closeSink plays the remaining data of the Player's sink and closes it.
+func (player *Player) closeSink() error {
+	if player.sinkFormat == nil {
+		return nil
+	}
+	player.sinkFormat = nil
+	err := player.sink.Drain()
+	if err != nil {
+		player.sink.Close()
+		return err
+	}
+	return player.sink.Close()
+}
+
+// seekReader applies the Player's pending seeks of track before reading.
+type seekReader struct {
+	TrackReader
+	player *Player
+	track  *Track
+}
+
+func (r *seekReader) Read(p []byte) (int, error) {
+	if position, ok := r.player.takePendingSeek(r.track); ok {
+		err := r.TrackReader.Seek(position)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.TrackReader.Read(p)
+}
+
+// takePendingSeek returns and clears the pending seek position of the given
+// Track.
+func (player *Player) takePendingSeek(track *Track) (time.Duration, bool) {
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	return player.takePendingSeekLocked(track)
+}
+
+// takePendingSeekLocked is takePendingSeek for callers holding seekMutex.
+// Pending seeks of other Tracks are outdated and dropped.
+func (player *Player) takePendingSeekLocked(track *Track) (time.Duration, bool) {
+	seek := player.pendingSeek
+	player.pendingSeek = nil
+	if seek == nil || seek.track != track {
+		return 0, false
+	}
+	return seek.position, true
+}
+
+// isPlaying reports whether the Play goroutine is playing a Track.
+func (player *Player) isPlaying() bool {
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	return player.playing
+}
+
+func (player *Player) setPlaying(playing bool) {
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	player.playing = playing
+}
+
+// stopPlaying marks the Player as not playing anymore after playing track.
+// A seek which was requested but not applied anymore is moved into track.
+func (player *Player) stopPlaying(track *Track) {
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	player.playing = false
+	if position, ok := player.takePendingSeekLocked(track); ok {
+		track.position = position
+		track.paused = true
+	}
+}
+
+// doSeek moves the current Track to the given offset. While playing, the
+// seek is applied by the Play goroutine, otherwise the paused Track's
+// position is set directly. The caller has to hold commandMutex.
+func (player *Player) doSeek(offset time.Duration) {
+	track := player.getCurrent()
+	if track == nil {
+		return
+	}
+	position := min(max(0, offset), track.duration)
+
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	if player.playing {
+		player.pendingSeek = &pendingSeek{track: track, position: position}
+		return
+	}
+	track.position = position
+	track.paused = true
+}
+
+// playedOffset returns the offset of the given Track's position, taking a
+// not yet applied seek into account.
+func (player *Player) playedOffset(track *Track) time.Duration {
+	player.seekMutex.Lock()
+	defer player.seekMutex.Unlock()
+
+	if seek := player.pendingSeek; seek != nil && seek.track == track {
+		return seek.position
+	}
+	return track.position
+}
+
+// Seek moves the current Track to the given offset from its beginning,
+// both while playing and while paused.
+func (player *Player) Seek(offset time.Duration) {
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	player.doSeek(offset)
+	player.saveStateAsync()
+}
+
+// scrubStep returns the step to scrub by for a button held for the given
+// duration; the longer the button is held, the faster it scrubs.
+func scrubStep(held time.Duration) time.Duration {
+	switch {
+	case held < 3*time.Second:
+		return 5 * time.Second
+	case held < 6*time.Second:
+		return 15 * time.Second
 	default:
-		return false
+		return 60 * time.Second
+	}
+}
+
+// Scrub moves the current Track forward (or backward) by a step growing
+// with the time the button is held. It is meant to be called repeatedly
+// while the button is held; the playback is paused until StopScrub.
+func (player *Player) Scrub(forward bool, held time.Duration) {
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	current := player.getCurrent()
+	if current == nil {
+		return
+	}
+	if !player.scrubbing {
+		player.scrubbing = true
+		player.scrubResume = player.isPlaying()
+		if player.scrubResume {
+			player.doToggle()
+		}
+	}
+	step := scrubStep(held)
+	if !forward {
+		step = -step
+	}
+	player.doSeek(player.playedOffset(current) + step)
+}
+
+// StopScrub ends scrubbing and resumes the playback, if the Player was
+// playing before.
+func (player *Player) StopScrub() {
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	if !player.scrubbing {
+		return
+	}
+	player.scrubbing = false
+	if player.scrubResume && !player.isPlaying() {
+		player.doToggle()
 	}
+	player.saveStateAsync()
 }
 
-func doPlay(ctx context.Context, t *Track) error {
+func (player *Player) doPlay(ctx context.Context, t *Track) error {
 	slog.Debug("doPlay begin", "Track", t.String())
 
-	// XXX: keep bufferSizeInBytes to fixed 4kB for now
-	bufferSizeInBytes := 4096
-	alsaplayer, err := alsa.NewPlayer(
-		t.metadata.sampleRate,
-		2, // anisse/alsa: enforce two channels, even for mono files
-		t.metadata.bytesPerSample,
-		bufferSizeInBytes,
-	)
+	err := player.openSink(outputFormat)
 	if err != nil {
 		return err
 	}
-	defer alsaplayer.Close()
 
-	reader, err := NewTrackReader(t)
+	trackReader, err := NewTrackReader(t)
+	if err != nil {
+		return err
+	}
+	defer trackReader.Close()
+	reader, err := newPCMConverter(trackReader, trackFormat(t), outputFormat)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
 
 	if t.paused {
-		_, err := reader.Seek(t.position, 0)
+		err := reader.Seek(t.position)
 		if err != nil {
 			return err
 		}
 		slog.Debug("continue paused track", "Track", t.String())
 	}
 
-	// alsaplayer.Write is not abortable/interruptable. WriteCtx is
+	// AudioSink.Write is not abortable/interruptable. WriteCtx is
 	// interruptable by introducing a contexed and buffered write.
-	err = WriteCtx(ctx, alsaplayer, reader, t)
+	reader = &seekReader{TrackReader: reader, player: player, track: t}
+	err = WriteCtx(ctx, &volumeWriter{dst: player.sink, player: player}, reader, t)
 	if err == context.Canceled && context.Cause(ctx) == cancelReasonPause {
 		t.paused = true
 	} else {
@@ -214,17 +629,35 @@ func (player *Player) Play() {
 				continue
 			}
 
-			player.playing = true
-			err := doPlay(player.ctx, t)
-			player.playing = false
+			player.setPlaying(true)
+			player.notify()
+			err := player.doPlay(player.ctx, t)
+			player.stopPlaying(t)
+			player.notify()
 
 			if err == context.Canceled {
 				slog.Debug("interrupt/cancelation", "Track", t.String())
+				if t.paused {
+					player.savePausedStateAsync()
+				} else {
+					player.saveStateAsync()
+				}
 				break
 			} else if err != nil {
 				slog.Error("doPlay() failed", "Track", t.String(), "error", err)
 			}
-			player.setCurrentNext()
+			proceed := player.advance(err != nil)
+			player.updateBookmark()
+			if player.sleepTimerEndOfTrack() {
+				slog.Info("sleep timer expired at the end of the track, pause playback", "Track", t.String())
+				player.savePausedStateAsync()
+				break
+			}
+			if !proceed {
+				slog.Info("end of directory reached, pause playback", "Track", t.String())
+				player.savePausedStateAsync()
+				break
+			}
 		}
 	}
 }
@@ -251,7 +684,7 @@ func (player *Player) resetCancel(cancelReason error) {
 }
 
 func (player *Player) doToggle() {
-	wasPlaying := player.playing
+	wasPlaying := player.isPlaying()
 	player.resetCancel(cancelReasonPause)
 	if !wasPlaying {
 		player.sendPlaySignal()
@@ -261,26 +694,70 @@ func (player *Player) doToggle() {
 func (player *Player) doNext() {
 	player.resetCancel(cancelReasonNext)
 	player.setCurrentNext()
+	player.updateBookmark()
 	player.sendPlaySignal()
 }
 
 func (player *Player) doPrevious() {
 	player.resetCancel(cancelReasonPrevious)
 	player.setCurrentPrevious()
+	player.updateBookmark()
 	player.sendPlaySignal()
 }
 
 func (player *Player) Command(cmd CommandVal) {
+	player.CommandValue(cmd, 0)
+}
+
+// CommandValue executes a command taking a value (e.g. SET_VOLUME); the value
+// is ignored by all other commands.
+func (player *Player) CommandValue(cmd CommandVal, value int) {
 	player.commandMutex.Lock()
 	defer player.commandMutex.Unlock()
+	defer player.notify()
 
 	switch cmd {
+	// the volume is persisted by the periodic state saver, avoiding a /perm
+	// remount on every button press
+	case VOLUME_UP:
+		player.setVolume(player.Volume() + VOLUME_STEP)
+	case VOLUME_DOWN:
+		player.setVolume(player.Volume() - VOLUME_STEP)
+	case SET_VOLUME:
+		player.setVolume(value)
 	case NEXT:
 		player.doNext()
+		player.saveStateAsync()
 	case PREVIOUS:
 		player.doPrevious()
+		player.saveStateAsync()
 	case TOGGLE:
 		player.doToggle()
+	case PAUSE:
+		if player.isPlaying() {
+			player.doToggle()
+		}
+	case PLAY:
+		if !player.isPlaying() {
+			player.doToggle()
+		}
+	case SEEK_RELATIVE:
+		current := player.getCurrent()
+		if current == nil {
+			return
+		}
+		player.doSeek(player.playedOffset(current) + time.Duration(value)*time.Second)
+		player.saveStateAsync()
+	case CYCLE_REPEAT_MODE:
+		err := player.SetRepeatMode(player.getSettings().RepeatMode.next())
+		if err != nil {
+			slog.Error("setting repeat mode failed", "err", err)
+		}
+	case TOGGLE_SHUFFLE:
+		err := player.SetShuffle(!player.getSettings().Shuffle)
+		if err != nil {
+			slog.Error("setting shuffle failed", "err", err)
+		}
 	default:
 		slog.Error("unknown command", "cmd", cmd)
 	}
@@ -294,6 +771,7 @@ func (player *Player) RfidUidReceiver(uidpass chan string) {
 
 			if player.rtm.SetMapping(uid) == true {
 				slog.Info("linked RFID UID to current TrackTrainer", "uid", uid)
+				player.notify()
 				continue
 			} else {
 				slog.Debug("no rfid-track-linking to learn")
@@ -301,25 +779,40 @@ func (player *Player) RfidUidReceiver(uidpass chan string) {
 
 			// TODO: ignore uid if learning happend the last 3 seconds
 
-			track := player.rtm.GetTrack(uid)
-			if track == nil {
+			if _, ok := player.rtm.GetMapping(uid); !ok {
 				slog.Error("could not find track for given rfid uid", "uid", uid)
 				continue
 			}
-			if track == player.getCurrent() {
+			if uid == player.getActiveUid() && player.isPlaying() {
 				slog.Debug("respective track already playing, do nothing", "uid", uid)
 				continue
 			}
 
-			slog.Debug("about to play track corresponding to rfid uid", "uid", uid, "track", track.String())
-			// pause currently played track; will save the current position
-			if player.playing {
-				player.Command(TOGGLE)
-				time.Sleep(50 * time.Millisecond)
+			// pause the currently played track, which keeps its position,
+			// and wait until the Play goroutine stopped playing it
+			if player.isPlaying() {
+				player.Command(PAUSE)
+				player.waitStopped()
 			}
-			// play the new track
+			// bookmark where the previous rfid uid stopped
+			player.saveBookmark()
+
+			// continue at the bookmark; for a directory mapping, this is
+			// the directory's last played track
+			mapping, _ := player.rtm.GetMapping(uid)
+			track := mapping.Track
+			if !track.SetPosition(mapping.Position) {
+				slog.Error("invalid bookmark, start from the beginning", "uid", uid, "track", track.String(), "position", mapping.Position)
+				track.SetPosition(0)
+			}
+			track.paused = true
+
+			slog.Debug("about to play track corresponding to rfid uid", "uid", uid, "track", track.String(), "directory", mapping.Directory)
+			// play the new track (within the new scope)
+			player.setActiveUid(uid)
+			player.setScope(mapping.Directory)
 			player.setCurrent(track)
-			player.Command(TOGGLE)
+			player.Command(PLAY)
 		}
 	}()
 }
@@ -0,0 +1,273 @@
+package godible
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestPlayer creates a Player of Tracks at the given (not existing) paths,
+// each 10 seconds long. Its RFID mappings are persisted to t's temporary
+// directory.
+func newTestPlayer(t *testing.T, paths ...string) *Player {
+	p := &Player{
+		TrackList: list.New(),
+		rtm:       newRfidTrackManager(filepath.Join(t.TempDir(), "rfid-mappings.json")),
+	}
+	for _, path := range paths {
+		p.TrackList.PushBack(&Track{
+			Path:     path,
+			duration: 10 * time.Second,
+			metadata: &Metadata{audioFormat: WAV, bytesPerSample: 2, sampleRate: 8000, channelNum: 2},
+		})
+	}
+	return p
+}
+
+func TestScopedNavigation(t *testing.T) {
+	p := newTestPlayer(t, "/a/1.wav", "/b/1.wav", "/b/2.wav", "/c/1.wav")
+	p.setScope("/b")
+	p.setCurrent(p.findTrack("/b/1.wav"))
+
+	for _, expected := range []string{"/b/2.wav", "/b/1.wav", "/b/2.wav"} {
+		p.setCurrentNext()
+		if current := p.getCurrent(); current.Path != expected {
+			t.Errorf("next: expected %s, got %s", expected, current.Path)
+		}
+	}
+	for _, expected := range []string{"/b/1.wav", "/b/2.wav"} {
+		p.setCurrentPrevious()
+		if current := p.getCurrent(); current.Path != expected {
+			t.Errorf("previous: expected %s, got %s", expected, current.Path)
+		}
+	}
+
+	// without a scope, the whole tracklist is played
+	p.setScope("")
+	for _, expected := range []string{"/c/1.wav", "/a/1.wav"} {
+		p.setCurrentNext()
+		if current := p.getCurrent(); current.Path != expected {
+			t.Errorf("next: expected %s, got %s", expected, current.Path)
+		}
+	}
+}
+
+// writeWavFile writes pcm as 16bit stereo WAV file of the given sample rate.
+func writeWavFile(t *testing.T, path string, sampleRate int, pcm []byte) {
+	sink := &WavFileSink{Path: path}
+	err := sink.Open(AudioFormat{SampleRate: sampleRate, ChannelNum: 2, BytesPerSample: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sink.Write(pcm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoPlayWavFileSink(t *testing.T) {
+	tmpDir := t.TempDir()
+	pcm := make([]byte, 44100)
+	for i := range pcm {
+		pcm[i] = byte(i % 251)
+	}
+	inputPath := filepath.Join(tmpDir, "input.wav")
+	writeWavFile(t, inputPath, 44100, pcm)
+	track, err := NewTrack(inputPath)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+
+	outputPath := filepath.Join(tmpDir, "output.wav")
+	p := &Player{sink: &WavFileSink{Path: outputPath}}
+	// at full volume, the PCM data is passed through unscaled
+	p.volume.Store(MAX_VOLUME)
+	err = p.doPlay(context.Background(), track)
+	if err != nil {
+		t.Fatalf("doPlay failed: %+v", err)
+	}
+	err = p.closeSink()
+	if err != nil {
+		t.Fatalf("closeSink failed: %+v", err)
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	input, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, input) {
+		t.Errorf("expected the output file to equal the input file (len %d); got len %d", len(input), len(output))
+	}
+}
+
+func TestDoPlayCanceled(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.wav")
+	writeWavFile(t, inputPath, 48000, make([]byte, 48000*4))
+	track, err := NewTrack(inputPath)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+
+	sink := &DiscardSink{}
+	p := &Player{sink: sink}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(cancelReasonPause)
+	err = p.doPlay(ctx, track)
+	if err != context.Canceled {
+		t.Fatalf("expected doPlay to be canceled; got %+v", err)
+	}
+	if !track.paused {
+		t.Errorf("expected track to be paused")
+	}
+	if sink.Written != 0 {
+		t.Errorf("expected no data written; got %d bytes", sink.Written)
+	}
+}
+
+func TestSeekPaused(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.wav")
+	writeWavFile(t, inputPath, 44100, make([]byte, 44100*4))
+	track, err := NewTrack(inputPath)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+	p := newTestPlayer(t)
+	p.TrackList.PushBack(track)
+	p.setCurrent(track)
+
+	p.doSeek(500 * time.Millisecond)
+	if expected := 500 * time.Millisecond; track.position != expected || !track.paused {
+		t.Errorf("expected paused track at position %s, got %s (paused: %t)", expected, track.String(), track.paused)
+	}
+
+	p.CommandValue(SEEK_RELATIVE, -10)
+	if track.position != 0 {
+		t.Errorf("expected track at its beginning, got %s", track.String())
+	}
+	p.CommandValue(SEEK_RELATIVE, 10)
+	if track.position != track.duration {
+		t.Errorf("expected track at its end, got %s", track.String())
+	}
+}
+
+func TestSeekWhilePlaying(t *testing.T) {
+	tmpDir := t.TempDir()
+	pcm := make([]byte, 44100*4)
+	for i := range pcm {
+		pcm[i] = byte(i % 251)
+	}
+	inputPath := filepath.Join(tmpDir, "input.wav")
+	writeWavFile(t, inputPath, 44100, pcm)
+	track, err := NewTrack(inputPath)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+	outputPath := filepath.Join(tmpDir, "output.wav")
+	p := newTestPlayer(t)
+	p.TrackList.PushBack(track)
+	p.setCurrent(track)
+	p.sink = &WavFileSink{Path: outputPath}
+	p.volume.Store(MAX_VOLUME)
+	// the seek is requested while playing, hence applied by doPlay
+	p.setPlaying(true)
+	p.doSeek(750 * time.Millisecond)
+	err = p.doPlay(context.Background(), track)
+	if err != nil {
+		t.Fatalf("doPlay failed: %+v", err)
+	}
+	p.stopPlaying(track)
+	err = p.closeSink()
+	if err != nil {
+		t.Fatalf("closeSink failed: %+v", err)
+	}
+
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output[wavHeaderSize:], pcm[len(pcm)/4*3:]) {
+		t.Errorf("expected the output to be the input's last quarter; got len %d", len(output)-wavHeaderSize)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.wav")
+	writeWavFile(t, inputPath, 8000, make([]byte, 8000*4*60))
+	track, err := NewTrack(inputPath)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+	p := newTestPlayer(t)
+	p.TrackList.PushBack(track)
+	p.setCurrent(track)
+
+	p.Scrub(true, HOLD_BUTTON_PRESS_DURATION)
+	p.Scrub(true, 4*time.Second)
+	if track.position != 20*time.Second {
+		t.Errorf("expected position 20s, got %s", track.position)
+	}
+	p.Scrub(false, HOLD_BUTTON_PRESS_DURATION)
+	if track.position != 15*time.Second {
+		t.Errorf("expected position 15s, got %s", track.position)
+	}
+	p.StopScrub()
+	if p.scrubbing || p.playing {
+		t.Errorf("expected the paused player to stay paused after scrubbing")
+	}
+}
+
+func TestRfidUidSwitch(t *testing.T) {
+	dir := t.TempDir()
+	p := newTestPlayer(t)
+	p.sink = &DiscardSink{Realtime: true}
+	p.playSignal = make(chan bool)
+	tracks := map[string]*Track{}
+	for _, uid := range []string{"aa", "bb"} {
+		path := filepath.Join(dir, uid+".wav")
+		writeWavFile(t, path, 8000, make([]byte, 8000*4*60))
+		track, err := NewTrack(path)
+		if err != nil {
+			t.Fatalf("NewTrack failed: %+v", err)
+		}
+		p.TrackList.PushBack(track)
+		p.rtm.SetTrackTrainer(track, "")
+		p.rtm.SetMapping(uid)
+		tracks[uid] = track
+	}
+	go p.Play()
+	uids := make(chan string)
+	p.RfidUidReceiver(uids)
+
+	playing := func(track *Track) func() bool {
+		return func() bool { return p.isPlaying() && p.getCurrent() == track }
+	}
+	uids <- "aa"
+	if !waitFor(t, time.Second, playing(tracks["aa"])) {
+		t.Fatalf("expected to play %s", tracks["aa"])
+	}
+	time.Sleep(200 * time.Millisecond)
+	// switching the tag pauses the playing track, instead of toggling the
+	// playback twice
+	uids <- "bb"
+	if !waitFor(t, time.Second, playing(tracks["bb"])) {
+		t.Fatalf("expected to play %s", tracks["bb"])
+	}
+	if mapping, _ := p.rtm.GetMapping("aa"); mapping.Position == 0 {
+		t.Errorf("expected a bookmark of uid aa, got %+v", mapping)
+	}
+	p.Command(PAUSE)
+	p.waitStopped()
+	p.Shutdown()
+}
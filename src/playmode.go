@@ -0,0 +1,156 @@
+package godible
+
+import (
+	"cmp"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// RepeatMode determines how the playback continues at the end of a Track.
+type RepeatMode string
+
+const (
+	// REPEAT_ALL continues with the next Track, wrapping around at the end
+	// of the TrackList (or the Player's scope)
+	REPEAT_ALL RepeatMode = "all"
+	// REPEAT_ONE plays the current Track again
+	REPEAT_ONE RepeatMode = "one"
+	// REPEAT_DIRECTORY continues with the next Track of the current
+	// Track's directory, wrapping around at its end
+	REPEAT_DIRECTORY RepeatMode = "directory"
+	// STOP_AT_DIRECTORY_END works like REPEAT_DIRECTORY, but pauses the
+	// playback after the directory's last Track
+	STOP_AT_DIRECTORY_END RepeatMode = "stop_directory"
+)
+
+// repeatModes lists the RepeatModes in the order CYCLE_REPEAT_MODE steps
+// through them.
+var repeatModes = []RepeatMode{REPEAT_ALL, REPEAT_ONE, REPEAT_DIRECTORY, STOP_AT_DIRECTORY_END}
+
+func (mode RepeatMode) valid() bool {
+	return slices.Contains(repeatModes, mode)
+}
+
+// perDirectory reports whether the mode restricts the playback to the
+// current Track's directory.
+func (mode RepeatMode) perDirectory() bool {
+	return mode == REPEAT_DIRECTORY || mode == STOP_AT_DIRECTORY_END
+}
+
+// next returns the RepeatMode following mode in repeatModes.
+func (mode RepeatMode) next() RepeatMode {
+	i := slices.Index(repeatModes, mode)
+	return repeatModes[(i+1)%len(repeatModes)]
+}
+
+// shuffleRank returns the Track's rank in the shuffled order given by seed.
+// It only depends on the Track's path, hence the shuffled order stays the
+// same across restarts and changes of the TrackList.
+func shuffleRank(seed uint64, track *Track) uint64 {
+	hash := fnv.New64a()
+	hash.Write(binary.LittleEndian.AppendUint64(nil, seed))
+	hash.Write([]byte(track.Path))
+	return hash.Sum64()
+}
+
+// orderedStep returns the element following (or preceding) Player.current
+// in the TrackList's order, skipping the elements not accepted by inRange.
+// It also returns whether it wrapped around at the TrackList's borders. The
+// caller has to hold currentMutex.
+func (player *Player) orderedStep(previous bool, inRange func(*list.Element) bool) (*list.Element, bool) {
+	element := player.current
+	wrapped := false
+	for range player.TrackList.Len() {
+		if element != nil && previous {
+			element = element.Prev()
+		} else if element != nil {
+			element = element.Next()
+		}
+		if element == nil {
+			wrapped = true
+			if previous {
+				element = player.TrackList.Back()
+			} else {
+				element = player.TrackList.Front()
+			}
+		}
+		if element != nil && inRange(element) {
+			return element, wrapped
+		}
+	}
+	return nil, true
+}
+
+// shuffleStep works like orderedStep, but in the shuffled order given by
+// seed. The caller has to hold currentMutex.
+func (player *Player) shuffleStep(previous bool, seed uint64, inRange func(*list.Element) bool) (*list.Element, bool) {
+	compare := func(a, b *list.Element) int {
+		trackA, _ := a.Value.(*Track)
+		trackB, _ := b.Value.(*Track)
+		c := cmp.Compare(shuffleRank(seed, trackA), shuffleRank(seed, trackB))
+		if c == 0 {
+			c = strings.Compare(trackA.Path, trackB.Path)
+		}
+		if previous {
+			return -c
+		}
+		return c
+	}
+	var first, following *list.Element
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		if !inRange(element) {
+			continue
+		}
+		if first == nil || compare(element, first) < 0 {
+			first = element
+		}
+		if player.current != nil && compare(element, player.current) > 0 &&
+			(following == nil || compare(element, following) < 0) {
+			following = element
+		}
+	}
+	if following != nil {
+		return following, false
+	}
+	return first, true
+}
+
+// advance moves Player.current on after the playback of a Track ended
+// (failed, if failed is true) according to the RepeatMode. It returns false,
+// if the playback is to be paused.
+func (player *Player) advance(failed bool) bool {
+	mode := player.getSettings().RepeatMode
+	if mode == REPEAT_ONE && !failed {
+		return true
+	}
+	wrapped := player.setCurrentNext()
+	return !wrapped || mode != STOP_AT_DIRECTORY_END
+}
+
+// SetRepeatMode sets and persists the Player's RepeatMode.
+func (player *Player) SetRepeatMode(mode RepeatMode) error {
+	if !mode.valid() {
+		return fmt.Errorf("%w: repeat mode %q", errInvalidArgument, mode)
+	}
+	return player.updateSettings(func(settings *Settings) {
+		settings.RepeatMode = mode
+	})
+}
+
+// SetShuffle enables (or disables) and persists the shuffled playback. Each
+// time it is enabled, a new shuffled order is chosen.
+func (player *Player) SetShuffle(shuffle bool) error {
+	return player.updateSettings(func(settings *Settings) {
+		if shuffle && !settings.Shuffle {
+			settings.ShuffleSeed = rand.Uint64()
+			slog.Debug("new shuffled order", "seed", settings.ShuffleSeed)
+		}
+		settings.Shuffle = shuffle
+	})
+}
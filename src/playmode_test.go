@@ -0,0 +1,87 @@
+package godible
+
+import (
+	"slices"
+	"testing"
+)
+
+var playModeTestPaths = []string{"/a/1.wav", "/b/1.wav", "/b/2.wav", "/b/3.wav", "/c/1.wav"}
+
+func TestRepeatModes(t *testing.T) {
+	tests := []struct {
+		mode     RepeatMode
+		expected []string
+		// paused is the index of the Track after which the playback is
+		// paused; -1 if it is not paused
+		paused int
+	}{
+		{REPEAT_ALL, []string{"/b/3.wav", "/c/1.wav", "/a/1.wav", "/b/1.wav"}, -1},
+		{REPEAT_ONE, []string{"/b/2.wav", "/b/2.wav"}, -1},
+		{REPEAT_DIRECTORY, []string{"/b/3.wav", "/b/1.wav", "/b/2.wav"}, -1},
+		{STOP_AT_DIRECTORY_END, []string{"/b/3.wav", "/b/1.wav", "/b/2.wav"}, 1},
+	}
+	for _, test := range tests {
+		p := newTestPlayer(t, playModeTestPaths...)
+		p.settings = Settings{RepeatMode: test.mode}
+		p.setCurrent(p.findTrack("/b/2.wav"))
+		for i, expected := range test.expected {
+			proceed := p.advance(false)
+			if current := p.getCurrent(); current.Path != expected {
+				t.Errorf("%s: expected %s, got %s", test.mode, expected, current.Path)
+			}
+			if proceed != (i != test.paused) {
+				t.Errorf("%s: after %s expected to proceed: %t", test.mode, expected, i != test.paused)
+			}
+		}
+	}
+
+	// a failing Track is not repeated endlessly
+	p := newTestPlayer(t, playModeTestPaths...)
+	p.settings = Settings{RepeatMode: REPEAT_ONE}
+	p.setCurrent(p.findTrack("/b/2.wav"))
+	p.advance(true)
+	if current := p.getCurrent(); current.Path != "/b/3.wav" {
+		t.Errorf("expected to skip the failed track, got %s", current.Path)
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	shuffled := func(seed uint64, previous bool) []string {
+		p := newTestPlayer(t, playModeTestPaths...)
+		p.settings = Settings{Shuffle: true, ShuffleSeed: seed}
+		p.setCurrent(p.findTrack("/b/2.wav"))
+		var paths []string
+		for range 2 * p.TrackList.Len() {
+			if previous {
+				p.setCurrentPrevious()
+			} else {
+				p.setCurrentNext()
+			}
+			paths = append(paths, p.getCurrent().Path)
+		}
+		return paths
+	}
+
+	order := shuffled(42, false)
+	// every Track is played once per round, in the same order each round
+	round := slices.Clone(order[:5])
+	slices.Sort(round)
+	if !slices.Equal(round, []string{"/a/1.wav", "/b/1.wav", "/b/2.wav", "/b/3.wav", "/c/1.wav"}) {
+		t.Errorf("expected every track once per round, got %v", order)
+	}
+	if !slices.Equal(order[:5], order[5:]) {
+		t.Errorf("expected a stable shuffled order, got %v", order)
+	}
+	if !slices.Equal(order, shuffled(42, false)) {
+		t.Errorf("expected the same shuffled order for the same seed")
+	}
+
+	// previous walks the shuffled order backwards
+	backwards := shuffled(42, true)
+	for i := range 5 {
+		if backwards[i] != order[(2*5-2-i)%5] {
+			t.Errorf("expected previous to reverse the shuffled order, got %v for %v", backwards, order)
+			break
+		}
+	}
+}
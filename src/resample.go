@@ -0,0 +1,166 @@
+package godible
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// outputFormat is the format all Tracks are converted to before being
+// written to the Player's sink. Keeping it fixed avoids reopening the sink
+// on every Track change.
+var outputFormat = AudioFormat{
+	SampleRate:     44100,
+	ChannelNum:     2,
+	BytesPerSample: 2,
+}
+
+// trackFormat returns the format of the PCM data read by the Track's
+// TrackReader.
+func trackFormat(t *Track) AudioFormat {
+	return AudioFormat{
+		SampleRate:     t.metadata.sampleRate,
+		ChannelNum:     t.metadata.channelNum,
+		BytesPerSample: t.metadata.bytesPerSample,
+	}
+}
+
+// pcmConverter converts the PCM data of a TrackReader into 16bit stereo PCM
+// data of another sample rate. The sample rate is converted via linear
+// interpolation, which is cheap enough for a Raspberry Pi Zero.
+//
+// All other TrackReader functions are passed through. Position refers to the
+// frames read from the source, which may be buffered but not yet converted.
+type pcmConverter struct {
+	TrackReader
+	in  AudioFormat
+	out AudioFormat
+	src *bufio.Reader
+	// step is the distance between two output frames in input frames
+	step float64
+	// frac is the position of the next output frame between prev and next
+	frac       float64
+	prev, next [2]int16
+	primed     bool
+	// drained is true, once the last input frame has been read
+	drained bool
+	frame   []byte
+}
+
+func newPCMConverter(reader TrackReader, in AudioFormat, out AudioFormat) (TrackReader, error) {
+	if in == out {
+		return reader, nil
+	}
+	if out.ChannelNum != 2 || out.BytesPerSample != 2 {
+		return nil, fmt.Errorf("unsupported output format: %+v", out)
+	}
+	if in.ChannelNum < 1 || in.BytesPerSample < 1 || in.BytesPerSample > 4 || in.SampleRate <= 0 {
+		return nil, fmt.Errorf("unsupported input format: %+v", in)
+	}
+	return &pcmConverter{
+		TrackReader: reader,
+		in:          in,
+		out:         out,
+		src:         bufio.NewReaderSize(reader, 4096),
+		step:        float64(in.SampleRate) / float64(out.SampleRate),
+		frame:       make([]byte, in.ChannelNum*in.BytesPerSample),
+	}, nil
+}
+
+// decodeSample converts a little endian sample of 1 to 4 bytes into 16bit.
+func decodeSample(b []byte) int16 {
+	switch len(b) {
+	case 1:
+		// 8bit WAV data is unsigned
+		return int16(int(b[0])-128) << 8
+	case 2:
+		return int16(binary.LittleEndian.Uint16(b))
+	default:
+		// keep the most significant 16bit
+		return int16(binary.LittleEndian.Uint16(b[len(b)-2:]))
+	}
+}
+
+// readFrame reads the next input frame as stereo frame. Mono is duplicated,
+// channels beyond the second are dropped.
+func (c *pcmConverter) readFrame() ([2]int16, error) {
+	var frame [2]int16
+	_, err := io.ReadFull(c.src, c.frame)
+	if err != nil {
+		return frame, err
+	}
+	bps := c.in.BytesPerSample
+	frame[0] = decodeSample(c.frame[:bps])
+	frame[1] = frame[0]
+	if c.in.ChannelNum > 1 {
+		frame[1] = decodeSample(c.frame[bps : 2*bps])
+	}
+	return frame, nil
+}
+
+func (c *pcmConverter) Read(p []byte) (int, error) {
+	if !c.primed {
+		var err error
+		c.prev, err = c.readFrame()
+		if err != nil {
+			return 0, eofError(err)
+		}
+		c.next, err = c.readFrame()
+		if eofError(err) == io.EOF {
+			c.next = c.prev
+			c.drained = true
+		} else if err != nil {
+			return 0, err
+		}
+		c.primed = true
+	}
+
+	n := 0
+	for ; n+4 <= len(p); n += 4 {
+		for c.frac >= 1 {
+			if c.drained {
+				if n == 0 {
+					return 0, io.EOF
+				}
+				return n, nil
+			}
+			frame, err := c.readFrame()
+			if eofError(err) == io.EOF {
+				// interpolate towards the last frame itself
+				frame = c.next
+				c.drained = true
+			} else if err != nil {
+				return n, err
+			}
+			c.prev, c.next = c.next, frame
+			c.frac -= 1
+		}
+		for channel := range 2 {
+			prev, next := float64(c.prev[channel]), float64(c.next[channel])
+			sample := prev + c.frac*(next-prev)
+			binary.LittleEndian.PutUint16(p[n+2*channel:], uint16(int16(sample)))
+		}
+		c.frac += c.step
+	}
+	return n, nil
+}
+
+// Seek seeks the source and discards the buffered input.
+func (c *pcmConverter) Seek(offset time.Duration) error {
+	err := c.TrackReader.Seek(offset)
+	c.src.Reset(c.TrackReader)
+	c.primed = false
+	c.drained = false
+	c.frac = 0
+	return err
+}
+
+// eofError maps an incomplete trailing frame to io.EOF.
+func eofError(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return io.EOF
+	}
+	return err
+}
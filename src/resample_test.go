@@ -0,0 +1,97 @@
+package godible
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// bytesTrackReader is a TrackReader of in-memory PCM data.
+type bytesTrackReader struct {
+	*bytes.Reader
+}
+
+func (b bytesTrackReader) Close() error {
+	return nil
+}
+
+func (b bytesTrackReader) Seek(offset time.Duration) error {
+	return errors.New("bytesTrackReader: seeking is not supported")
+}
+
+func (b bytesTrackReader) Position() (time.Duration, error) {
+	return 0, nil
+}
+
+func (b bytesTrackReader) Duration() (time.Duration, error) {
+	return 0, nil
+}
+
+func convertAll(t *testing.T, pcm []byte, in AudioFormat) []int16 {
+	reader, err := newPCMConverter(bytesTrackReader{bytes.NewReader(pcm)}, in, outputFormat)
+	if err != nil {
+		t.Fatalf("newPCMConverter failed: %+v", err)
+	}
+	out, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %+v", err)
+	}
+	samples := make([]int16, len(out)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(out[2*i:]))
+	}
+	return samples
+}
+
+func TestPCMConverterUpsampleMono(t *testing.T) {
+	pcm := []byte{}
+	for _, sample := range []int16{0, 1000, 2000, -2000} {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(sample))
+	}
+	in := AudioFormat{SampleRate: outputFormat.SampleRate / 2, ChannelNum: 1, BytesPerSample: 2}
+	samples := convertAll(t, pcm, in)
+
+	expected := []int16{0, 500, 1000, 1500, 2000, 0, -2000}
+	if len(samples) < 2*len(expected) {
+		t.Fatalf("expected at least %d samples; got %d", 2*len(expected), len(samples))
+	}
+	for i, sample := range expected {
+		if samples[2*i] != sample || samples[2*i+1] != sample {
+			t.Errorf("frame %d: expected %d/%d; got %d/%d", i, sample, sample, samples[2*i], samples[2*i+1])
+		}
+	}
+}
+
+func TestPCMConverter24Bit(t *testing.T) {
+	// two stereo frames of 24bit samples
+	pcm := []byte{
+		0x11, 0x34, 0x12, 0x22, 0xcd, 0xab,
+		0x33, 0x00, 0x80, 0x44, 0xff, 0x7f,
+	}
+	in := AudioFormat{SampleRate: outputFormat.SampleRate, ChannelNum: 2, BytesPerSample: 3}
+	samples := convertAll(t, pcm, in)
+
+	expected := []int16{0x1234, -0x5433, -0x8000, 0x7fff}
+	if len(samples) != len(expected) {
+		t.Fatalf("expected %d samples; got %d", len(expected), len(samples))
+	}
+	for i, sample := range expected {
+		if samples[i] != sample {
+			t.Errorf("sample %d: expected %d; got %d", i, sample, samples[i])
+		}
+	}
+}
+
+func TestPCMConverterPassthrough(t *testing.T) {
+	reader := bytesTrackReader{bytes.NewReader(nil)}
+	converter, err := newPCMConverter(reader, outputFormat, outputFormat)
+	if err != nil {
+		t.Fatalf("newPCMConverter failed: %+v", err)
+	}
+	if converter != reader {
+		t.Errorf("expected the TrackReader to be passed through")
+	}
+}
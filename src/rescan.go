@@ -0,0 +1,211 @@
+package godible
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+var errRescanRunning = fmt.Errorf("%w: rescan already running", errConflict)
+
+// libraryRescan scans the data directory in the background and replaces the
+// TrackList by the scanned one, e.g. if the library watcher missed changes.
+type libraryRescan struct {
+	mutex   sync.Mutex
+	running bool
+	// total is the number of files to scan; zero while still counting
+	total    int64
+	progress *ScanProgress
+	// err is the error of the last rescan, if it failed
+	err error
+	// scanMutex is held while the data directory is scanned and the
+	// TrackList swapped. The library watcher defers its changes meanwhile,
+	// so that the swap does not drop Tracks it added during the scan.
+	scanMutex sync.Mutex
+}
+
+// RescanStatus reports the progress of the running (or the last) rescan.
+type RescanStatus struct {
+	Running bool  `json:"running"`
+	Total   int64 `json:"total"`
+	Scanned int64 `json:"scanned"`
+	Skipped int64 `json:"skipped"`
+	Errors  int64 `json:"errors"`
+	// Error is set, if the rescan failed
+	Error string `json:"error,omitempty"`
+}
+
+// RescanStatus returns the progress of the running (or the last) rescan.
+func (player *Player) RescanStatus() RescanStatus {
+	rescan := &player.rescan
+	rescan.mutex.Lock()
+	defer rescan.mutex.Unlock()
+
+	status := RescanStatus{
+		Running: rescan.running,
+		Total:   rescan.total,
+	}
+	if rescan.progress != nil {
+		status.Scanned = rescan.progress.Scanned.Load()
+		status.Skipped = rescan.progress.Skipped.Load()
+		status.Errors = rescan.progress.Errors.Load()
+	}
+	if rescan.err != nil {
+		status.Error = rescan.err.Error()
+	}
+	return status
+}
+
+// Rescan starts scanning the data directory in the background. Afterwards,
+// the scanned Tracks replace the TrackList, see swapTrackList.
+func (player *Player) Rescan() error {
+	rescan := &player.rescan
+	rescan.mutex.Lock()
+	defer rescan.mutex.Unlock()
+
+	if rescan.running {
+		return errRescanRunning
+	}
+	rescan.running = true
+	rescan.total = 0
+	rescan.progress = &ScanProgress{}
+	rescan.err = nil
+	go player.runRescan(rescan.progress)
+	return nil
+}
+
+func (player *Player) runRescan(progress *ScanProgress) {
+	err := player.doRescan(progress)
+	if err != nil {
+		slog.Error("rescan failed", "path", player.dataDir, "err", err)
+	}
+
+	rescan := &player.rescan
+	rescan.mutex.Lock()
+	defer rescan.mutex.Unlock()
+
+	rescan.running = false
+	rescan.err = err
+}
+
+func (player *Player) doRescan(progress *ScanProgress) error {
+	slog.Info("rescan started", "path", player.dataDir)
+	player.rescan.scanMutex.Lock()
+	defer player.rescan.scanMutex.Unlock()
+
+	total, err := countFiles(player.dataDir)
+	if err != nil {
+		return err
+	}
+	player.rescan.mutex.Lock()
+	player.rescan.total = total
+	player.rescan.mutex.Unlock()
+
+	idx := player.trackIndex
+	if idx != nil {
+		idx.beginScan()
+	}
+	scanned := list.New()
+	err = scanTrackList(scanned, player.dataDir, idx, progress)
+	if err != nil {
+		return err
+	}
+	settings := player.getSettings()
+	sortTrackList(scanned, settings.SortOrder, settings.DirectoryOrder)
+	player.swapTrackList(scanned)
+
+	if idx != nil {
+		idx.prune()
+		err = idx.Save()
+		if err != nil {
+			slog.Error("saving track index failed", "path", idx.path, "err", err)
+		}
+	}
+	slog.Info("rescan finished", "path", player.dataDir, "tracks", scanned.Len(),
+		"scanned", progress.Scanned.Load(), "skipped", progress.Skipped.Load(), "errors", progress.Errors.Load())
+	return nil
+}
+
+// swapTrackList replaces the Tracks of the TrackList by the sorted Tracks of
+// scanned in one go. The current Track is kept, even if it was not scanned
+// anymore; the other Tracks keep their positions and RFID mappings.
+func (player *Player) swapTrackList(scanned *list.List) {
+	settings := player.getSettings()
+	// serialize with the deleting, renaming and moving of files
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	replaced := make(map[*Track]*Track)
+	var removed []*Track
+
+	player.currentMutex.Lock()
+	var current *Track
+	if player.current != nil {
+		current, _ = player.current.Value.(*Track)
+	}
+	existing := make(map[string]*Track)
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		if track, _ := element.Value.(*Track); track != nil {
+			existing[track.Path] = track
+		}
+	}
+	tracks := make([]*Track, 0, scanned.Len()+1)
+	keptCurrent := current == nil
+	for element := scanned.Front(); element != nil; element = element.Next() {
+		track, _ := element.Value.(*Track)
+		if track == nil {
+			continue
+		}
+		if old, ok := existing[track.Path]; ok {
+			delete(existing, track.Path)
+			switch {
+			case old == current:
+				// the current Track is not disturbed
+				track = old
+				keptCurrent = true
+			case old != track:
+				if old.position <= track.duration {
+					track.position = old.position
+					track.paused = old.paused
+				}
+				replaced[old] = track
+			}
+		}
+		tracks = append(tracks, track)
+	}
+	if !keptCurrent {
+		delete(existing, current.Path)
+		index := len(tracks)
+		for i, track := range tracks {
+			if compareTracks(current, track, settings.SortOrder, settings.DirectoryOrder) < 0 {
+				index = i
+				break
+			}
+		}
+		tracks = append(tracks[:index], append([]*Track{current}, tracks[index:]...)...)
+	}
+	for _, track := range existing {
+		removed = append(removed, track)
+	}
+	player.TrackList.Init()
+	player.current = nil
+	for _, track := range tracks {
+		element := player.TrackList.PushBack(track)
+		if track == current {
+			player.current = element
+		}
+	}
+	player.currentMutex.Unlock()
+
+	for old, track := range replaced {
+		player.rtm.replaceTrack(old, track)
+	}
+	for _, track := range removed {
+		slog.Info("rescan: removed track", "track", track.String())
+		player.rtm.forgetTrack(track, player.findDirectoryTrack)
+	}
+	player.rtm.resolve(player.findTrack, player.findDirectoryTrack)
+	player.saveStateAsync()
+	player.notify()
+}
@@ -0,0 +1,89 @@
+package godible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRescan(t *testing.T) {
+	p := newLibraryTestPlayer(t, "a/1.wav", "a/2.wav", "b/1.wav")
+	current := p.findTrack(filepath.Join(p.dataDir, "a", "2.wav"))
+	p.setCurrent(current)
+	other := p.findTrack(filepath.Join(p.dataDir, "b", "1.wav"))
+	other.SetPosition(500 * time.Millisecond)
+	p.rtm.UidTrackMap["track"] = &TrackMapping{Track: other}
+
+	// changes the library watcher did not see
+	err := os.Remove(current.Path)
+	if err == nil {
+		err = os.Remove(filepath.Join(p.dataDir, "a", "1.wav"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeWavFile(t, filepath.Join(p.dataDir, "c.wav"), 44100, make([]byte, 4*44100))
+	err = os.WriteFile(filepath.Join(p.dataDir, "notes.txt"), []byte("no audio"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Rescan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, 10*time.Second, func() bool { return !p.RescanStatus().Running }) {
+		t.Fatal("expected the rescan to finish")
+	}
+	status := p.RescanStatus()
+	if status.Error != "" || status.Total != 3 || status.Scanned != 3 || status.Errors != 1 {
+		t.Errorf("unexpected rescan status: %+v", status)
+	}
+
+	// the removed current track is kept until it is not current anymore
+	expected := []string{
+		filepath.Join(p.dataDir, "c.wav"),
+		current.Path,
+		filepath.Join(p.dataDir, "b", "1.wav"),
+	}
+	tracks := p.tracks()
+	if len(tracks) != len(expected) {
+		t.Fatalf("expected tracks %v, got %v", expected, tracks)
+	}
+	for i, track := range tracks {
+		if track.Path != expected[i] {
+			t.Errorf("expected %s at index %d, got %s", expected[i], i, track.Path)
+		}
+	}
+	if p.getCurrent() != current {
+		t.Errorf("expected the current track to be kept, got %s", p.getCurrent())
+	}
+	rescanned := p.findTrack(other.Path)
+	if rescanned.position != other.position {
+		t.Errorf("expected the position to be kept, got %s", rescanned.position)
+	}
+	if track := p.rtm.GetTrack("track"); track != rescanned {
+		t.Errorf("expected the rfid mapping to refer to the rescanned track, got %s", track)
+	}
+}
+
+func TestRescanDefersWatcher(t *testing.T) {
+	p := newLibraryTestPlayer(t, "a/1.wav")
+	w := &libraryWatcher{player: p, idx: p.trackIndex, pending: make(map[string]time.Time)}
+	path := filepath.Join(p.dataDir, "a", "2.wav")
+	writeWavFile(t, path, 44100, make([]byte, 4*44100))
+	w.pending[path] = time.Now().Add(-WATCH_SETTLE_DURATION)
+
+	// a running rescan would drop the track added meanwhile by its swap
+	p.rescan.scanMutex.Lock()
+	w.applySettled()
+	if p.findTrack(path) != nil || len(w.pending) != 1 {
+		t.Errorf("expected the change to be deferred during the rescan")
+	}
+	p.rescan.scanMutex.Unlock()
+	w.applySettled()
+	if p.findTrack(path) == nil || len(w.pending) != 0 {
+		t.Errorf("expected the change to be applied after the rescan")
+	}
+}
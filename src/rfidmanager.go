@@ -1,38 +1,63 @@
 package godible
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	TrackTrainingSeconds = 10
+	RFID_MAPPINGS_FILE   = DATADIR + "rfid-mappings.json"
+	// rfidMappingsVersion is the current version of the RFID_MAPPINGS_FILE
+	// format. Bump it on incompatible changes of rfidMappingsFile. Version
+	// 1 stored the positions in TrackReader specific units, it is
+	// converted on loading.
+	rfidMappingsVersion = 2
 )
 
-// TODO: replace Track with struct that contains "Track" or "Directory and Track"
+// TrackTrainer represents a Track (or a directory) waiting to be linked to
+// the next read RFID UID. For a directory, Track is its first Track.
 type TrackTrainer struct {
 	Track     *Track
+	Directory string
 	TimeStamp int64
 	Done      bool
 	TimeLeft  int64
 }
 
-func newTrackTrainer(track *Track) *TrackTrainer {
+func newTrackTrainer(track *Track, directory string) *TrackTrainer {
 	return &TrackTrainer{
 		Track:     track,
+		Directory: directory,
 		TimeStamp: time.Now().UnixNano(),
 		TimeLeft:  TrackTrainingSeconds,
 	}
 }
 
+// Name returns the name of the Track or directory to be learned.
+func (t *TrackTrainer) Name() string {
+	if t.Directory != "" {
+		return dirnameShow(t.Directory)
+	}
+	return t.Track.Basename()
+}
+
 func (t *TrackTrainer) String() string {
 	if t == nil {
 		return "nil"
 	}
 	return fmt.Sprintf(
-		"TrackTrainer{Track: %s, TimeStamp: %d, Done: %t}",
+		"TrackTrainer{Track: %s, Directory: %s, TimeStamp: %d, Done: %t}",
 		t.Track.Path,
+		t.Directory,
 		t.TimeStamp,
 		t.Done,
 	)
@@ -41,23 +66,331 @@ func (t *TrackTrainer) String() string {
 // In order to support a RFID UID <-> Directory mapping, extend the Track type
 // with a directory path. During playing the directory, the track pointer moves
 // also on, pointing to the last track being played.
+//
+// Position and LastPlayed bookmark where the playback of the mapping stopped
+// the last time, so that reading the RFID UID again continues right there.
 type TrackMapping struct {
 	*Track
 	Directory string
+	Position  time.Duration
+	// LastPlayed is the unix timestamp of the bookmark's last update
+	LastPlayed int64
+}
+
+// rfidMappingsFile is the on-disk representation of the UidTrackMap.
+type rfidMappingsFile struct {
+	Version  int                    `json:"version"`
+	Mappings []rfidMappingFileEntry `json:"mappings"`
+}
+
+// rfidMappingFileEntry represents a TrackMapping. For a directory mapping,
+// Path is the last Track played within the directory.
+type rfidMappingFileEntry struct {
+	Uid       string `json:"uid"`
+	Path      string `json:"path"`
+	Directory string `json:"directory"`
+	// Position is the offset from the Track's beginning in nanoseconds
+	Position   time.Duration `json:"position"`
+	LastPlayed int64         `json:"last_played"`
 }
 
 type RfidTrackManager struct {
+	// mutex protects UidTrackMap, TrackTrainer and unresolved, as they are
+	// accessed by the RFID receiver as well as by the web interface
+	mutex        sync.Mutex
 	UidTrackMap  map[string]*TrackMapping
 	TrackTrainer *TrackTrainer
+	// path is the file the mappings are persisted to
+	path string
+	// unresolved holds loaded mappings whose track could not be found.
+	// They are kept (and saved again), so that e.g. a temporarily missing
+	// file does not lose its mapping.
+	unresolved map[string]rfidMappingFileEntry
+	// bookmarksChanged is set, if a bookmark changed since the mappings
+	// have been persisted (see saveBookmarks)
+	bookmarksChanged bool
 }
 
-func newRfidTrackManager() *RfidTrackManager {
+func newRfidTrackManager(path string) *RfidTrackManager {
 	return &RfidTrackManager{
 		UidTrackMap: make(map[string]*TrackMapping),
+		path:        path,
+		unresolved:  make(map[string]rfidMappingFileEntry),
+	}
+}
+
+// load reads the persisted mappings and resolves their paths via findTrack.
+// If the last Track of a directory mapping is gone, the directory's first
+// Track is looked up via findDirectoryTrack instead. A missing mappings file
+// is not an error (e.g. on first start). Mappings whose track can not be
+// found are reported and kept as unresolved.
+func (rtm *RfidTrackManager) load(findTrack func(path string) *Track, findDirectoryTrack func(directory string) *Track) error {
+	data, err := os.ReadFile(rtm.path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no persisted rfid mappings found", "path", rtm.path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var mappingsFile rfidMappingsFile
+	err = json.Unmarshal(data, &mappingsFile)
+	if err != nil {
+		return err
+	}
+	if mappingsFile.Version != rfidMappingsVersion && mappingsFile.Version != 1 {
+		return fmt.Errorf("unsupported rfid mappings version %d (expected %d)", mappingsFile.Version, rfidMappingsVersion)
+	}
+
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	for _, entry := range mappingsFile.Mappings {
+		mapping := resolveMapping(entry, mappingsFile.Version, findTrack, findDirectoryTrack)
+		if mapping == nil {
+			slog.Warn("rfid mapping: track does not exist (anymore)", "uid", entry.Uid, "path", entry.Path)
+			if mappingsFile.Version == 1 {
+				// the position can not be converted without
+				// the track
+				entry.Position = 0
+			}
+			rtm.unresolved[entry.Uid] = entry
+			continue
+		}
+		rtm.UidTrackMap[entry.Uid] = mapping
+	}
+	slog.Info("loaded rfid mappings", "path", rtm.path, "resolved", len(rtm.UidTrackMap), "unresolved", len(rtm.unresolved))
+	return nil
+}
+
+// resolveMapping creates the TrackMapping of a persisted mapping of the
+// given format version. It returns nil, if the mapping's track can not be
+// found.
+func resolveMapping(entry rfidMappingFileEntry, version int, findTrack func(path string) *Track, findDirectoryTrack func(directory string) *Track) *TrackMapping {
+	track := findTrack(entry.Path)
+	if track == nil && entry.Directory != "" {
+		track = findDirectoryTrack(entry.Directory)
+	}
+	if track == nil {
+		return nil
+	}
+	mapping := &TrackMapping{
+		Track:      track,
+		Directory:  entry.Directory,
+		LastPlayed: entry.LastPlayed,
+	}
+	// the bookmark is only valid for the track it was taken of
+	if track.Path == filepath.Clean(entry.Path) {
+		mapping.Position = entry.Position
+		if version == 1 {
+			mapping.Position = track.legacyPosition(int64(entry.Position))
+		}
+	}
+	return mapping
+}
+
+// resolve retries to resolve the unresolved mappings, e.g. after tracks
+// have been added. Resolved mappings are persisted.
+func (rtm *RfidTrackManager) resolve(findTrack func(path string) *Track, findDirectoryTrack func(directory string) *Track) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	resolved := 0
+	for uid, entry := range rtm.unresolved {
+		mapping := resolveMapping(entry, rfidMappingsVersion, findTrack, findDirectoryTrack)
+		if mapping == nil {
+			continue
+		}
+		slog.Info("rfid mapping: track exists again", "uid", uid, "path", mapping.Path)
+		rtm.UidTrackMap[uid] = mapping
+		delete(rtm.unresolved, uid)
+		resolved++
+	}
+	if resolved == 0 {
+		return
+	}
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+}
+
+// replaceTrack makes the mappings of the Track old refer to the Track new
+// instead, e.g. after the Track's file changed.
+func (rtm *RfidTrackManager) replaceTrack(old *Track, new *Track) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	for _, mapping := range rtm.UidTrackMap {
+		if mapping.Track == old {
+			mapping.Track = new
+			mapping.Position = min(mapping.Position, new.duration)
+		}
+	}
+	if rtm.TrackTrainer != nil && rtm.TrackTrainer.Track == old {
+		rtm.TrackTrainer.Track = new
+	}
+}
+
+// forgetTrack updates the mappings of a removed Track: a directory mapping
+// continues at the directory's first remaining Track (as returned by
+// findDirectoryTrack), all others become unresolved. Changed mappings are
+// persisted.
+func (rtm *RfidTrackManager) forgetTrack(track *Track, findDirectoryTrack func(directory string) *Track) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	changed := false
+	for uid, mapping := range rtm.UidTrackMap {
+		if mapping.Track != track {
+			continue
+		}
+		changed = true
+		if mapping.Directory != "" {
+			if first := findDirectoryTrack(mapping.Directory); first != nil {
+				mapping.Track = first
+				mapping.Position = 0
+				continue
+			}
+		}
+		slog.Warn("rfid mapping: track has been removed", "uid", uid, "path", track.Path)
+		rtm.unresolved[uid] = rfidMappingFileEntry{
+			Uid:        uid,
+			Path:       mapping.Path,
+			Directory:  mapping.Directory,
+			Position:   mapping.Position,
+			LastPlayed: mapping.LastPlayed,
+		}
+		delete(rtm.UidTrackMap, uid)
+	}
+	if !changed {
+		return
+	}
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+}
+
+// moveTracks makes the mappings refer to the moved Tracks (mapping the
+// original Tracks to their replacements) after the file or directory src
+// has been moved to dst. Directory mappings and unresolved mappings within
+// src are moved as well. The mappings are persisted.
+func (rtm *RfidTrackManager) moveTracks(moved map[*Track]*Track, src string, dst string) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	for _, mapping := range rtm.UidTrackMap {
+		if track, ok := moved[mapping.Track]; ok {
+			mapping.Track = track
+		}
+		if mapping.Directory != "" && withinPath(mapping.Directory, src) {
+			mapping.Directory = movedPath(mapping.Directory, src, dst)
+		}
+	}
+	for uid, entry := range rtm.unresolved {
+		if withinPath(entry.Path, src) {
+			entry.Path = movedPath(entry.Path, src, dst)
+		}
+		if entry.Directory != "" && withinPath(entry.Directory, src) {
+			entry.Directory = movedPath(entry.Directory, src, dst)
+		}
+		rtm.unresolved[uid] = entry
+	}
+	if rtm.TrackTrainer != nil {
+		if track, ok := moved[rtm.TrackTrainer.Track]; ok {
+			rtm.TrackTrainer.Track = track
+		}
+		if rtm.TrackTrainer.Directory != "" && withinPath(rtm.TrackTrainer.Directory, src) {
+			rtm.TrackTrainer.Directory = movedPath(rtm.TrackTrainer.Directory, src, dst)
+		}
+	}
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+}
+
+// dropUnresolved deletes the unresolved mappings of the deleted file or
+// directory path, as their tracks will not exist again. The mappings are
+// persisted.
+func (rtm *RfidTrackManager) dropUnresolved(path string) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	dropped := 0
+	for uid, entry := range rtm.unresolved {
+		if withinPath(entry.Path, path) || entry.Directory != "" && withinPath(entry.Directory, path) {
+			slog.Info("rfid mapping: delete mapping of deleted track", "uid", uid, "path", entry.Path)
+			delete(rtm.unresolved, uid)
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return
+	}
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+}
+
+// save persists all (resolved and unresolved) mappings. The caller has to
+// hold rtm.mutex.
+func (rtm *RfidTrackManager) save() error {
+	mappingsFile := rfidMappingsFile{Version: rfidMappingsVersion}
+	for uid, mapping := range rtm.UidTrackMap {
+		mappingsFile.Mappings = append(mappingsFile.Mappings, rfidMappingFileEntry{
+			Uid:        uid,
+			Path:       mapping.Path,
+			Directory:  mapping.Directory,
+			Position:   mapping.Position,
+			LastPlayed: mapping.LastPlayed,
+		})
 	}
+	for _, entry := range rtm.unresolved {
+		mappingsFile.Mappings = append(mappingsFile.Mappings, entry)
+	}
+	data, err := json.MarshalIndent(mappingsFile, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = writePermFile(rtm.path, data)
+	if err != nil {
+		return err
+	}
+	rtm.bookmarksChanged = false
+	return nil
+}
+
+// saveBookmarks persists the mappings, if a bookmark changed since they have
+// been persisted the last time.
+func (rtm *RfidTrackManager) saveBookmarks() error {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	if !rtm.bookmarksChanged {
+		return nil
+	}
+	return rtm.save()
+}
+
+// GetMapping returns a copy of the mapping of the given RFID UID.
+func (rtm *RfidTrackManager) GetMapping(rfidUid string) (TrackMapping, bool) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	mapping, ok := rtm.UidTrackMap[rfidUid]
+	if !ok {
+		return TrackMapping{}, false
+	}
+	return *mapping, true
 }
 
 func (rtm *RfidTrackManager) GetTrack(rfidUid string) *Track {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
 	el, ok := rtm.UidTrackMap[rfidUid]
 	if ok {
 		return el.Track
@@ -65,57 +398,259 @@ func (rtm *RfidTrackManager) GetTrack(rfidUid string) *Track {
 	return nil
 }
 
-// TODO also implement directory case
+// GetUid returns the RFID UID linked to the given Track. Directory mappings
+// are not taken into account (see GetDirectoryUid).
 func (rtm *RfidTrackManager) GetUid(track *Track) string {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	for key, value := range rtm.UidTrackMap {
+		if value.Directory == "" && track == value.Track {
+			return key
+		}
+	}
+	return ""
+}
+
+// GetDirectoryUid returns the RFID UID linked to the given directory.
+func (rtm *RfidTrackManager) GetDirectoryUid(directory string) string {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
 	for key, value := range rtm.UidTrackMap {
-		if track == value.Track {
+		if value.Directory != "" && directory == value.Directory {
 			return key
 		}
 	}
 	return ""
 }
 
-func (rtm *RfidTrackManager) deleteMappings(track *Track, rfidUid string) {
+// deleteMappings deletes the mappings of the given RFID UID as well as the
+// mappings of the given mapping's Track (or directory).
+func (rtm *RfidTrackManager) deleteMappings(mapping *TrackMapping, rfidUid string) {
 	for key, value := range rtm.UidTrackMap {
-		if key == rfidUid || track == value.Track {
+		if key == rfidUid || value.Directory == mapping.Directory &&
+			(mapping.Directory != "" || value.Track == mapping.Track) {
 			delete(rtm.UidTrackMap, key)
 		}
 	}
+	delete(rtm.unresolved, rfidUid)
+}
+
+// setBookmark bookmarks the given Track and position for the mapping of the
+// given RFID UID. For a directory mapping, track becomes the last Track
+// played within the directory. Tracks not belonging to the mapping are
+// ignored. As the bookmark changes with every Track, it is only kept in
+// memory; see saveBookmarks.
+func (rtm *RfidTrackManager) setBookmark(rfidUid string, track *Track, position time.Duration) {
+	if rfidUid == "" || track == nil {
+		return
+	}
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	mapping, ok := rtm.UidTrackMap[rfidUid]
+	if !ok {
+		return
+	}
+	if mapping.Directory == "" && mapping.Track != track {
+		return
+	}
+	if mapping.Directory != "" && mapping.Directory != track.DirnameFull() {
+		return
+	}
+	if mapping.Track == track && mapping.Position == position {
+		return
+	}
+	mapping.Track = track
+	mapping.Position = position
+	mapping.LastPlayed = time.Now().Unix()
+	rtm.bookmarksChanged = true
+}
+
+// resetBookmark resets the bookmark of the given RFID UID's mapping to the
+// beginning of its Track, or of its directory's first Track (as returned by
+// findDirectoryTrack). It returns false, if there is no such mapping.
+func (rtm *RfidTrackManager) resetBookmark(rfidUid string, findDirectoryTrack func(directory string) *Track) bool {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	mapping, ok := rtm.UidTrackMap[rfidUid]
+	if !ok {
+		return false
+	}
+	if mapping.Directory != "" {
+		track := findDirectoryTrack(mapping.Directory)
+		if track != nil {
+			mapping.Track = track
+		}
+	}
+	mapping.Position = 0
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+	return true
 }
 
-// TODO also implement directory case
-// Set a new RFID UID Track mapping, only if a TrackTrainer is
-// also set. Existing mappings with the given RFID UID or track will be deleted.
+// Set a new RFID UID Track (or directory) mapping, only if a TrackTrainer is
+// also set. Existing mappings with the given RFID UID or Track (or directory)
+// will be deleted. The resulting mappings are persisted.
 func (rtm *RfidTrackManager) SetMapping(rfidUid string) bool {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
 	if rtm.TrackTrainer == nil {
 		return false
 	}
-	track := rtm.TrackTrainer.Track
-	rtm.deleteMappings(track, rfidUid)
-	rtm.UidTrackMap[rfidUid] = &TrackMapping{Track: track, Directory: ""}
+	rtm.putMapping(rfidUid, &TrackMapping{
+		Track:     rtm.TrackTrainer.Track,
+		Directory: rtm.TrackTrainer.Directory,
+	})
 	rtm.TrackTrainer = nil
 	return true
 }
 
+// putMapping links the given RFID UID to mapping, replacing the previous
+// mappings of both and persists the mappings. It returns whether the RFID
+// UID was unknown before. The caller has to hold rtm.mutex.
+func (rtm *RfidTrackManager) putMapping(rfidUid string, mapping *TrackMapping) bool {
+	_, resolved := rtm.UidTrackMap[rfidUid]
+	_, unresolved := rtm.unresolved[rfidUid]
+	rtm.deleteMappings(mapping, rfidUid)
+	rtm.UidTrackMap[rfidUid] = mapping
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+	return !resolved && !unresolved
+}
+
+// PutMapping links the given RFID UID to track, or to the directory whose
+// first Track is track. It returns whether the RFID UID was unknown before.
+func (rtm *RfidTrackManager) PutMapping(rfidUid string, track *Track, directory string) bool {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	return rtm.putMapping(rfidUid, &TrackMapping{Track: track, Directory: directory})
+}
+
+// DeleteMapping deletes the (resolved or unresolved) mapping of the given
+// RFID UID and persists the mappings. It returns false, if there is none.
+func (rtm *RfidTrackManager) DeleteMapping(rfidUid string) bool {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	_, resolved := rtm.UidTrackMap[rfidUid]
+	_, unresolved := rtm.unresolved[rfidUid]
+	if !resolved && !unresolved {
+		return false
+	}
+	delete(rtm.UidTrackMap, rfidUid)
+	delete(rtm.unresolved, rfidUid)
+	err := rtm.save()
+	if err != nil {
+		slog.Error("failed to persist rfid mappings", "path", rtm.path, "err", err)
+	}
+	return true
+}
+
+// RfidMapping is a copy of a resolved or unresolved mapping.
+type RfidMapping struct {
+	Uid       string `json:"uid"`
+	Path      string `json:"path"`
+	Directory string `json:"directory,omitempty"`
+	// Position is the bookmarked offset from the Track's beginning in
+	// milliseconds
+	Position   int64 `json:"position"`
+	LastPlayed int64 `json:"last_played"`
+	// Resolved is false, if the mapping's Track does not exist (anymore)
+	Resolved bool `json:"resolved"`
+}
+
+// Mappings returns copies of all mappings, ordered by their RFID UIDs.
+func (rtm *RfidTrackManager) Mappings() []RfidMapping {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	mappings := make([]RfidMapping, 0, len(rtm.UidTrackMap)+len(rtm.unresolved))
+	for uid, mapping := range rtm.UidTrackMap {
+		mappings = append(mappings, RfidMapping{
+			Uid:        uid,
+			Path:       mapping.Path,
+			Directory:  mapping.Directory,
+			Position:   mapping.Position.Milliseconds(),
+			LastPlayed: mapping.LastPlayed,
+			Resolved:   true,
+		})
+	}
+	for uid, entry := range rtm.unresolved {
+		mappings = append(mappings, RfidMapping{
+			Uid:        uid,
+			Path:       entry.Path,
+			Directory:  entry.Directory,
+			Position:   entry.Position.Milliseconds(),
+			LastPlayed: entry.LastPlayed,
+		})
+	}
+	slices.SortFunc(mappings, func(a, b RfidMapping) int {
+		return strings.Compare(a.Uid, b.Uid)
+	})
+	return mappings
+}
+
 func (rtm *RfidTrackManager) runTrackTrainerCountdown(oldTrackTrainer *TrackTrainer) {
 	slog.Debug("runTrackTrainerCountdown: begin", "oldTrackTrainer", oldTrackTrainer.String())
 	for range TrackTrainingSeconds {
 		time.Sleep(1 * time.Second)
-		if rtm.TrackTrainer == nil || rtm.TrackTrainer.TimeStamp != oldTrackTrainer.TimeStamp {
+		rtm.mutex.Lock()
+		if rtm.TrackTrainer != oldTrackTrainer {
+			rtm.mutex.Unlock()
 			slog.Debug("runTrackTrainerCountdown: nothing to reset, training already completed")
 			return
 		}
 		rtm.TrackTrainer.TimeLeft = rtm.TrackTrainer.TimeLeft - 1
+		rtm.mutex.Unlock()
 	}
-	rtm.TrackTrainer = nil
+	rtm.mutex.Lock()
+	if rtm.TrackTrainer == oldTrackTrainer {
+		rtm.TrackTrainer = nil
+	}
+	rtm.mutex.Unlock()
 	slog.Debug("runTrackTrainerCountdown: TrackTrainer reset", "oldTrackTrainer", oldTrackTrainer.String())
 }
 
-func (rtm *RfidTrackManager) SetTrackTrainer(track *Track) bool {
+// SetTrackTrainer starts learning a new RFID UID for the given Track. If
+// directory is not empty, the directory is learned instead and track has to
+// be its first Track.
+func (rtm *RfidTrackManager) SetTrackTrainer(track *Track, directory string) bool {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
 	if rtm.TrackTrainer != nil {
 		return false
 	}
-	rtm.TrackTrainer = newTrackTrainer(track)
+	rtm.TrackTrainer = newTrackTrainer(track, directory)
 	go rtm.runTrackTrainerCountdown(rtm.TrackTrainer)
 	return true
 }
+
+// StopTrackTrainer stops learning a new RFID UID.
+func (rtm *RfidTrackManager) StopTrackTrainer() {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	rtm.TrackTrainer = nil
+}
+
+// TrackTraining returns the name of the Track (or directory) being learned
+// and the seconds left to do so; an empty name, if none is learned.
+func (rtm *RfidTrackManager) TrackTraining() (string, int64) {
+	rtm.mutex.Lock()
+	defer rtm.mutex.Unlock()
+
+	if rtm.TrackTrainer == nil {
+		return "", 0
+	}
+	return rtm.TrackTrainer.Name(), rtm.TrackTrainer.TimeLeft
+}
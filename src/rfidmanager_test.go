@@ -0,0 +1,201 @@
+package godible
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRfidMappingsPersistence(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "rfid-mappings.json")
+	tracks := map[string]*Track{
+		"/a.wav": {Path: "/a.wav"},
+		"/b.wav": {Path: "/b.wav"},
+	}
+	findTrack := func(path string) *Track {
+		return tracks[path]
+	}
+	findDirectoryTrack := func(directory string) *Track {
+		return nil
+	}
+
+	rtm := newRfidTrackManager(mappingsPath)
+	for uid, path := range map[string]string{"aa": "/a.wav", "bb": "/b.wav"} {
+		if !rtm.SetTrackTrainer(tracks[path], "") {
+			t.Fatalf("SetTrackTrainer failed for %s", path)
+		}
+		if !rtm.SetMapping(uid) {
+			t.Fatalf("SetMapping failed for %s", uid)
+		}
+	}
+
+	// simulate a removed file: its mapping has to be kept as unresolved
+	delete(tracks, "/b.wav")
+	loaded := newRfidTrackManager(mappingsPath)
+	err := loaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	if track := loaded.GetTrack("aa"); track == nil || track.Path != "/a.wav" {
+		t.Errorf("expected uid aa to map to /a.wav, got %s", track.String())
+	}
+	if track := loaded.GetTrack("bb"); track != nil {
+		t.Errorf("expected uid bb to be unresolved, got %s", track.String())
+	}
+	if entry, ok := loaded.unresolved["bb"]; !ok || entry.Path != "/b.wav" {
+		t.Errorf("expected unresolved mapping for uid bb, got %+v", loaded.unresolved)
+	}
+
+	// unresolved mappings survive the next save
+	tracks["/b.wav"] = &Track{Path: "/b.wav"}
+	loaded.SetTrackTrainer(tracks["/a.wav"], "")
+	loaded.SetMapping("cc")
+	reloaded := newRfidTrackManager(mappingsPath)
+	err = reloaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	if reloaded.GetTrack("aa") != nil {
+		t.Errorf("expected uid aa to be replaced by uid cc")
+	}
+	if track := reloaded.GetTrack("cc"); track == nil || track.Path != "/a.wav" {
+		t.Errorf("expected uid cc to map to /a.wav, got %s", track.String())
+	}
+	if track := reloaded.GetTrack("bb"); track == nil || track.Path != "/b.wav" {
+		t.Errorf("expected uid bb to map to /b.wav again, got %s", track.String())
+	}
+}
+
+func TestRfidDirectoryMappingsPersistence(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "rfid-mappings.json")
+	tracks := map[string]*Track{
+		"/d/a.wav": {Path: "/d/a.wav"},
+		"/d/b.wav": {Path: "/d/b.wav"},
+	}
+	findTrack := func(path string) *Track {
+		return tracks[path]
+	}
+	findDirectoryTrack := func(directory string) *Track {
+		return tracks["/d/a.wav"]
+	}
+
+	rtm := newRfidTrackManager(mappingsPath)
+	rtm.SetTrackTrainer(tracks["/d/a.wav"], "/d")
+	rtm.SetMapping("dd")
+	if uid := rtm.GetDirectoryUid("/d"); uid != "dd" {
+		t.Errorf("expected directory uid dd, got %s", uid)
+	}
+	if uid := rtm.GetUid(tracks["/d/a.wav"]); uid != "" {
+		t.Errorf("expected no track uid for a directory mapping, got %s", uid)
+	}
+	rtm.setBookmark("dd", tracks["/d/b.wav"], 0)
+	rtm.saveBookmarks()
+
+	loaded := newRfidTrackManager(mappingsPath)
+	err := loaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	mapping, ok := loaded.GetMapping("dd")
+	if !ok || mapping.Directory != "/d" || mapping.Track != tracks["/d/b.wav"] {
+		t.Errorf("expected uid dd to map to /d at /d/b.wav, got %+v", mapping)
+	}
+
+	// the last played track is gone: fall back to the directory's first track
+	delete(tracks, "/d/b.wav")
+	loaded = newRfidTrackManager(mappingsPath)
+	err = loaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	mapping, ok = loaded.GetMapping("dd")
+	if !ok || mapping.Track != tracks["/d/a.wav"] {
+		t.Errorf("expected uid dd to map to /d/a.wav, got %+v", mapping)
+	}
+}
+
+func TestRfidBookmarks(t *testing.T) {
+	mappingsPath := filepath.Join(t.TempDir(), "rfid-mappings.json")
+	tracks := map[string]*Track{
+		"/a.wav":   {Path: "/a.wav"},
+		"/d/a.wav": {Path: "/d/a.wav"},
+		"/d/b.wav": {Path: "/d/b.wav"},
+	}
+	findTrack := func(path string) *Track {
+		return tracks[path]
+	}
+	findDirectoryTrack := func(directory string) *Track {
+		return tracks["/d/a.wav"]
+	}
+
+	rtm := newRfidTrackManager(mappingsPath)
+	rtm.SetTrackTrainer(tracks["/a.wav"], "")
+	rtm.SetMapping("aa")
+	rtm.SetTrackTrainer(tracks["/d/a.wav"], "/d")
+	rtm.SetMapping("dd")
+
+	rtm.setBookmark("aa", tracks["/a.wav"], 100)
+	// tracks not belonging to the mapping are ignored
+	rtm.setBookmark("aa", tracks["/d/b.wav"], 200)
+	rtm.setBookmark("dd", tracks["/a.wav"], 300)
+	rtm.setBookmark("dd", tracks["/d/b.wav"], 400)
+
+	// the bookmarks are only persisted by saveBookmarks
+	loaded := newRfidTrackManager(mappingsPath)
+	err := loaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	if mapping, _ := loaded.GetMapping("aa"); mapping.Position != 0 {
+		t.Errorf("expected the bookmark not to be persisted yet, got %+v", mapping)
+	}
+	err = rtm.saveBookmarks()
+	if err != nil {
+		t.Fatalf("saveBookmarks failed: %+v", err)
+	}
+	loaded = newRfidTrackManager(mappingsPath)
+	err = loaded.load(findTrack, findDirectoryTrack)
+	if err != nil {
+		t.Fatalf("load failed: %+v", err)
+	}
+	mapping, _ := loaded.GetMapping("aa")
+	if mapping.Track != tracks["/a.wav"] || mapping.Position != 100 || mapping.LastPlayed == 0 {
+		t.Errorf("expected bookmark /a.wav at 100, got %+v", mapping)
+	}
+	mapping, _ = loaded.GetMapping("dd")
+	if mapping.Track != tracks["/d/b.wav"] || mapping.Position != 400 || mapping.LastPlayed == 0 {
+		t.Errorf("expected bookmark /d/b.wav at 400, got %+v", mapping)
+	}
+
+	if !loaded.resetBookmark("dd", findDirectoryTrack) {
+		t.Fatalf("resetBookmark failed")
+	}
+	if loaded.resetBookmark("xx", findDirectoryTrack) {
+		t.Errorf("expected resetBookmark of an unknown uid to fail")
+	}
+	mapping, _ = loaded.GetMapping("dd")
+	if mapping.Track != tracks["/d/a.wav"] || mapping.Position != 0 {
+		t.Errorf("expected reset bookmark /d/a.wav at 0, got %+v", mapping)
+	}
+}
+
+func TestTrackTrainerStop(t *testing.T) {
+	rtm := newRfidTrackManager(filepath.Join(t.TempDir(), "rfid-mappings.json"))
+	track := &Track{Path: "/a.wav"}
+	if name, _ := rtm.TrackTraining(); name != "" {
+		t.Errorf("expected no track training, got %s", name)
+	}
+	rtm.SetTrackTrainer(track, "")
+	if name, timeLeft := rtm.TrackTraining(); name == "" || timeLeft != TrackTrainingSeconds {
+		t.Errorf("expected track training with %d seconds left, got %q %d", TrackTrainingSeconds, name, timeLeft)
+	}
+	rtm.StopTrackTrainer()
+	if name, _ := rtm.TrackTraining(); name != "" {
+		t.Errorf("expected stopped track training, got %s", name)
+	}
+	if rtm.SetMapping("aa") {
+		t.Errorf("expected SetMapping to fail after StopTrackTrainer")
+	}
+	if !rtm.SetTrackTrainer(track, "") {
+		t.Errorf("expected SetTrackTrainer to succeed after StopTrackTrainer")
+	}
+}
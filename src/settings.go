@@ -0,0 +1,110 @@
+package godible
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const (
+	SETTINGS_FILE = DATADIR + "settings.json"
+	// settingsVersion is the current version of the SETTINGS_FILE format.
+	// Bump it on incompatible changes of Settings.
+	settingsVersion = 1
+)
+
+// Settings holds the parent's configuration of the Player.
+type Settings struct {
+	Version int `json:"version"`
+	// MaxVolume limits the Player's volume (in percent)
+	MaxVolume int `json:"max_volume"`
+	// SortOrder and DirectoryOrder determine the order of the TrackList
+	SortOrder      SortOrder      `json:"sort_order"`
+	DirectoryOrder DirectoryOrder `json:"directory_order"`
+	RepeatMode     RepeatMode     `json:"repeat_mode"`
+	Shuffle        bool           `json:"shuffle"`
+	// ShuffleSeed determines the shuffled order (see shuffleRank)
+	ShuffleSeed uint64 `json:"shuffle_seed"`
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		Version:        settingsVersion,
+		MaxVolume:      MAX_VOLUME,
+		SortOrder:      SORT_NATURAL,
+		DirectoryOrder: FILES_FIRST,
+		RepeatMode:     REPEAT_ALL,
+	}
+}
+
+// loadSettings reads the Settings stored at path. If the file is missing,
+// the default Settings are returned.
+func loadSettings(path string) (Settings, error) {
+	settings := defaultSettings()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no settings found, use defaults", "path", path)
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return defaultSettings(), err
+	}
+	if settings.Version != settingsVersion {
+		return defaultSettings(), fmt.Errorf("unsupported settings version %d (expected %d)", settings.Version, settingsVersion)
+	}
+	if !settings.SortOrder.valid() {
+		slog.Error("invalid sort order, use default", "sort order", settings.SortOrder)
+		settings.SortOrder = SORT_NATURAL
+	}
+	if !settings.DirectoryOrder.valid() {
+		slog.Error("invalid directory order, use default", "directory order", settings.DirectoryOrder)
+		settings.DirectoryOrder = FILES_FIRST
+	}
+	if !settings.RepeatMode.valid() {
+		slog.Error("invalid repeat mode, use default", "repeat mode", settings.RepeatMode)
+		settings.RepeatMode = REPEAT_ALL
+	}
+	return settings, nil
+}
+
+// saveSettings stores the Settings at path; without a path (e.g. in tests),
+// they are not persisted.
+func saveSettings(path string, settings Settings) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writePermFile(path, data)
+}
+
+// getSettings returns a copy of the Player's Settings.
+func (player *Player) getSettings() Settings {
+	player.settingsMutex.Lock()
+	defer player.settingsMutex.Unlock()
+
+	return player.settings
+}
+
+// updateSettings modifies the Player's Settings via update and persists them.
+func (player *Player) updateSettings(update func(settings *Settings)) error {
+	player.settingsMutex.Lock()
+	defer player.settingsMutex.Unlock()
+
+	settings := player.settings
+	update(&settings)
+	err := saveSettings(player.settingsPath, settings)
+	if err != nil {
+		return err
+	}
+	player.settings = settings
+	return nil
+}
@@ -0,0 +1,231 @@
+package godible
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anisse/alsa"
+)
+
+// AudioFormat describes interleaved, signed, little endian PCM data.
+type AudioFormat struct {
+	SampleRate     int
+	ChannelNum     int
+	BytesPerSample int
+}
+
+// bytesPerSecond returns the amount of PCM bytes per second of audio.
+func (f AudioFormat) bytesPerSecond() int {
+	return f.SampleRate * f.ChannelNum * f.BytesPerSample
+}
+
+// AudioSink is the output the Player writes its PCM data to.
+//
+// Open prepares the sink for PCM data of the given format. Write blocks
+// until the data is accepted by the sink. Drain blocks until all written
+// data has been played. Close releases the sink; it may be opened again
+// afterwards.
+type AudioSink interface {
+	Open(format AudioFormat) error
+	Write(p []byte) (int, error)
+	Drain() error
+	Close() error
+}
+
+// NewAudioSink creates an AudioSink from its textual description:
+//   - "alsa": the sound card (default)
+//   - "discard": drop all data in real time, e.g. on a machine without
+//     sound card
+//   - "wav:<path>": write all data into the WAV file at <path>
+func NewAudioSink(spec string) (AudioSink, error) {
+	switch {
+	case spec == "" || spec == "alsa":
+		return &AlsaSink{}, nil
+	case spec == "discard":
+		return &DiscardSink{Realtime: true}, nil
+	case strings.HasPrefix(spec, "wav:"):
+		return &WavFileSink{Path: strings.TrimPrefix(spec, "wav:")}, nil
+	default:
+		return nil, fmt.Errorf("unknown audio sink: %s", spec)
+	}
+}
+
+// AlsaSink plays the PCM data on the (first) sound card.
+type AlsaSink struct {
+	player *alsa.Player
+	format AudioFormat
+}
+
+// XXX: keep alsaBufferSizeInBytes to fixed 4kB for now
+const alsaBufferSizeInBytes = 4096
+
+func (s *AlsaSink) Open(format AudioFormat) error {
+	player, err := alsa.NewPlayer(
+		format.SampleRate,
+		format.ChannelNum,
+		format.BytesPerSample,
+		alsaBufferSizeInBytes,
+	)
+	if err != nil {
+		return err
+	}
+	s.player = player
+	s.format = format
+	return nil
+}
+
+func (s *AlsaSink) Write(p []byte) (int, error) {
+	if s.player == nil {
+		return 0, errors.New("alsa sink: not opened")
+	}
+	n, err := s.player.Write(p)
+	if err != syscall.EPIPE {
+		return n, err
+	}
+	// EPIPE signals an underrun (e.g. after pausing); anisse/alsa does not
+	// expose a way to recover, hence reopen the device.
+	err = s.Close()
+	if err != nil {
+		return n, err
+	}
+	err = s.Open(s.format)
+	if err != nil {
+		return n, err
+	}
+	m, err := s.player.Write(p[n:])
+	return n + m, err
+}
+
+// Drain waits for the device's buffer to be played, as anisse/alsa does not
+// expose the corresponding ioctl.
+func (s *AlsaSink) Drain() error {
+	if s.player == nil {
+		return nil
+	}
+	bytesPerSecond := s.format.bytesPerSecond()
+	if bytesPerSecond > 0 {
+		time.Sleep(time.Duration(alsaBufferSizeInBytes) * time.Second / time.Duration(bytesPerSecond))
+	}
+	return nil
+}
+
+func (s *AlsaSink) Close() error {
+	if s.player == nil {
+		return nil
+	}
+	err := s.player.Close()
+	s.player = nil
+	return err
+}
+
+// DiscardSink drops all PCM data. If Realtime is set, Write blocks as long as
+// playing the data would take.
+type DiscardSink struct {
+	Realtime bool
+	// Written is the amount of bytes written since the last Open
+	Written int64
+	format  AudioFormat
+}
+
+func (s *DiscardSink) Open(format AudioFormat) error {
+	s.format = format
+	s.Written = 0
+	return nil
+}
+
+func (s *DiscardSink) Write(p []byte) (int, error) {
+	bytesPerSecond := s.format.bytesPerSecond()
+	if s.Realtime && bytesPerSecond > 0 {
+		time.Sleep(time.Duration(len(p)) * time.Second / time.Duration(bytesPerSecond))
+	}
+	s.Written += int64(len(p))
+	return len(p), nil
+}
+
+func (s *DiscardSink) Drain() error {
+	return nil
+}
+
+func (s *DiscardSink) Close() error {
+	return nil
+}
+
+// WavFileSink writes the PCM data into a WAV file at Path. Opening the sink
+// (re)creates the file, closing it finalizes the file's header.
+type WavFileSink struct {
+	Path    string
+	file    *os.File
+	format  AudioFormat
+	written int64
+}
+
+// wavHeaderSize is the size of the canonical RIFF/WAVE header written by
+// WavFileSink
+const wavHeaderSize = 44
+
+func (s *WavFileSink) Open(format AudioFormat) error {
+	if s.file != nil {
+		return errors.New("wav sink: already opened")
+	}
+	file, err := os.Create(s.Path)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.format = format
+	s.written = 0
+	return s.writeHeader()
+}
+
+func (s *WavFileSink) writeHeader() error {
+	header := make([]byte, wavHeaderSize)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(wavHeaderSize-8+s.written))
+	copy(header[8:], "WAVE")
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(s.format.ChannelNum))
+	binary.LittleEndian.PutUint32(header[24:], uint32(s.format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(s.format.bytesPerSecond()))
+	binary.LittleEndian.PutUint16(header[32:], uint16(s.format.ChannelNum*s.format.BytesPerSample))
+	binary.LittleEndian.PutUint16(header[34:], uint16(8*s.format.BytesPerSample))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(s.written))
+	_, err := s.file.WriteAt(header, 0)
+	return err
+}
+
+func (s *WavFileSink) Write(p []byte) (int, error) {
+	if s.file == nil {
+		return 0, errors.New("wav sink: not opened")
+	}
+	n, err := s.file.WriteAt(p, wavHeaderSize+s.written)
+	s.written += int64(n)
+	return n, err
+}
+
+func (s *WavFileSink) Drain() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+func (s *WavFileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.writeHeader()
+	errClose := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+	return errClose
+}
@@ -0,0 +1,151 @@
+package godible
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// SLEEP_TIMER_FADE_DURATION is the time the volume is faded out before
+	// the sleep timer pauses the playback
+	SLEEP_TIMER_FADE_DURATION = 5 * time.Second
+	SLEEP_TIMER_FADE_STEPS    = 50
+)
+
+// sleepTimer stops the playback either at a given point in time or at the
+// end of the current Track.
+type sleepTimer struct {
+	mutex sync.Mutex
+	// deadline is the point in time the playback is paused; zero if unset
+	deadline time.Time
+	// endOfTrack pauses the playback as soon as the current Track ends
+	endOfTrack bool
+	// stop terminates the countdown goroutine of deadline
+	stop chan struct{}
+}
+
+// SetSleepTimer pauses the playback after the given duration. The volume is
+// faded out during the last SLEEP_TIMER_FADE_DURATION. A duration <= 0
+// cancels the sleep timer.
+func (player *Player) SetSleepTimer(duration time.Duration) {
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	player.resetSleepTimer()
+	if duration <= 0 {
+		return
+	}
+	st.deadline = time.Now().Add(duration)
+	st.stop = make(chan struct{})
+	go player.runSleepTimer(st.deadline, st.stop)
+	slog.Info("sleep timer set", "deadline", st.deadline)
+}
+
+// SetSleepTimerEndOfTrack pauses the playback at the end of the current
+// Track.
+func (player *Player) SetSleepTimerEndOfTrack() {
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	player.resetSleepTimer()
+	st.endOfTrack = true
+	slog.Info("sleep timer set to the end of the current track")
+}
+
+// CancelSleepTimer cancels the sleep timer and restores the volume.
+func (player *Player) CancelSleepTimer() {
+	player.SetSleepTimer(0)
+}
+
+// SleepTimer returns the time left until the sleep timer pauses the
+// playback, and whether it pauses at the end of the current Track instead.
+// A zero duration and false mean the sleep timer is not set.
+func (player *Player) SleepTimer() (time.Duration, bool) {
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.deadline.IsZero() {
+		return 0, st.endOfTrack
+	}
+	return max(0, time.Until(st.deadline)), false
+}
+
+// resetSleepTimer unsets the sleep timer and stops a running fade-out. The
+// caller has to hold sleepTimer.mutex.
+func (player *Player) resetSleepTimer() {
+	st := &player.sleepTimer
+	if st.stop != nil {
+		close(st.stop)
+		st.stop = nil
+	}
+	st.deadline = time.Time{}
+	st.endOfTrack = false
+	player.fadeOut.Store(0)
+}
+
+// sleepTimerFade sets the fade-out of the countdown identified by stop. It
+// returns false, if the countdown was canceled meanwhile.
+func (player *Player) sleepTimerFade(stop chan struct{}, fadeOut int) bool {
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.stop != stop {
+		return false
+	}
+	player.fadeOut.Store(int32(fadeOut))
+	return true
+}
+
+// runSleepTimer waits for the deadline, fading out the volume right before
+// it, and pauses the playback.
+func (player *Player) runSleepTimer(deadline time.Time, stop chan struct{}) {
+	timer := time.NewTimer(time.Until(deadline) - SLEEP_TIMER_FADE_DURATION)
+	defer timer.Stop()
+	select {
+	case <-stop:
+		return
+	case <-timer.C:
+	}
+
+	ticker := time.NewTicker(SLEEP_TIMER_FADE_DURATION / SLEEP_TIMER_FADE_STEPS)
+	defer ticker.Stop()
+	for step := 1; step <= SLEEP_TIMER_FADE_STEPS; step++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !player.sleepTimerFade(stop, step*MAX_VOLUME/SLEEP_TIMER_FADE_STEPS) {
+			return
+		}
+	}
+
+	slog.Info("sleep timer expired, pause playback")
+	player.Command(PAUSE)
+
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	if st.stop == stop {
+		player.resetSleepTimer()
+	}
+}
+
+// sleepTimerEndOfTrack reports whether the playback has to be paused at the
+// end of the current Track. The sleep timer is reset in that case.
+func (player *Player) sleepTimerEndOfTrack() bool {
+	st := &player.sleepTimer
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if !st.endOfTrack {
+		return false
+	}
+	player.resetSleepTimer()
+	return true
+}
@@ -0,0 +1,54 @@
+package godible
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSleepTimer(t *testing.T) {
+	p := &Player{}
+
+	p.SetSleepTimer(time.Hour)
+	left, endOfTrack := p.SleepTimer()
+	if left <= 59*time.Minute || left > time.Hour || endOfTrack {
+		t.Errorf("expected about an hour left, got %s (end of track: %t)", left, endOfTrack)
+	}
+
+	p.SetSleepTimerEndOfTrack()
+	left, endOfTrack = p.SleepTimer()
+	if left != 0 || !endOfTrack {
+		t.Errorf("expected the sleep timer to be set to the end of the track, got %s (end of track: %t)", left, endOfTrack)
+	}
+	if !p.sleepTimerEndOfTrack() {
+		t.Errorf("expected the sleep timer to expire at the end of the track")
+	}
+	if p.sleepTimerEndOfTrack() {
+		t.Errorf("expected the sleep timer to expire only once")
+	}
+
+	p.CancelSleepTimer()
+	left, endOfTrack = p.SleepTimer()
+	if left != 0 || endOfTrack {
+		t.Errorf("expected the sleep timer to be unset, got %s (end of track: %t)", left, endOfTrack)
+	}
+}
+
+func TestSleepTimerFadeOutCanceled(t *testing.T) {
+	p := &Player{}
+	p.volume.Store(MAX_VOLUME)
+
+	// shorter than SLEEP_TIMER_FADE_DURATION: fading out starts right away
+	p.SetSleepTimer(time.Millisecond)
+	deadline := time.Now().Add(SLEEP_TIMER_FADE_DURATION / 2)
+	for p.fadeOut.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if gain := p.gain(); gain <= 0 || gain >= 1 {
+		t.Errorf("expected the gain to be fading out, got %f", gain)
+	}
+
+	p.CancelSleepTimer()
+	if gain := p.gain(); gain != 1 {
+		t.Errorf("expected the gain to be restored, got %f", gain)
+	}
+}
@@ -0,0 +1,223 @@
+package godible
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	STATE_FILE        = DATADIR + "state.json"
+	STATE_SAVE_PERIOD = time.Minute
+	// stateVersion is the current version of the STATE_FILE format. Bump
+	// it on incompatible changes of playerState. Version 1 stored the
+	// positions in TrackReader specific units, it is converted on loading.
+	stateVersion = 2
+)
+
+// playerState is the on-disk representation of the Player's state, which
+// survives reboots and power losses.
+type playerState struct {
+	Version int `json:"version"`
+	// Current is the path of Player.current
+	Current string `json:"current"`
+	// Scope is the directory the playback is restricted to (see Player.scope)
+	Scope string `json:"scope,omitempty"`
+	// RfidUid is the RFID UID whose mapping is played (see Player.activeUid)
+	RfidUid string `json:"rfid_uid,omitempty"`
+	// Playing is true, if the Player was playing at the time of saving
+	Playing bool `json:"playing"`
+	// Volume is the Player's volume in percent; nil for states saved
+	// before the volume was introduced
+	Volume *int         `json:"volume,omitempty"`
+	Tracks []trackState `json:"tracks"`
+}
+
+// trackState holds the state of a Track which has been started, but not
+// finished.
+type trackState struct {
+	Path string `json:"path"`
+	// Position is the offset from the Track's beginning in nanoseconds
+	Position time.Duration `json:"position"`
+	Paused   bool          `json:"paused"`
+}
+
+func (player *Player) snapshotState() playerState {
+	state := playerState{
+		Version: stateVersion,
+		Playing: player.isPlaying(),
+		Tracks:  []trackState{},
+	}
+	current := player.getCurrent()
+	if current != nil {
+		state.Current = current.Path
+	}
+	state.Scope = player.getScope()
+	state.RfidUid = player.getActiveUid()
+	volume := player.Volume()
+	state.Volume = &volume
+	for _, track := range player.tracks() {
+		if !track.paused && (track != current || track.position == 0) {
+			continue
+		}
+		state.Tracks = append(state.Tracks, trackState{
+			Path:     track.Path,
+			Position: track.position,
+			Paused:   track.paused,
+		})
+	}
+	return state
+}
+
+// SaveState persists the Player's state into Player.statePath. The file is
+// only written, if the state changed since the last save. Without a
+// statePath (e.g. in tests), the state is not persisted.
+func (player *Player) SaveState() error {
+	if player.statePath == "" {
+		return nil
+	}
+	player.stateMutex.Lock()
+	defer player.stateMutex.Unlock()
+
+	data, err := json.MarshalIndent(player.snapshotState(), "", "\t")
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, player.savedState) {
+		return nil
+	}
+	err = writePermFile(player.statePath, data)
+	if err != nil {
+		return err
+	}
+	player.savedState = data
+	slog.Debug("saved player state", "path", player.statePath)
+	return nil
+}
+
+// saveStateAsync saves the Player's state without blocking the caller, as
+// remounting /perm might take a while. The bookmark of the active RFID UID is
+// only updated in memory.
+func (player *Player) saveStateAsync() {
+	go func() {
+		player.updateBookmark()
+		err := player.SaveState()
+		if err != nil {
+			slog.Error("saving player state failed", "path", player.statePath, "err", err)
+		}
+	}()
+}
+
+// savePausedStateAsync is saveStateAsync for a paused playback, which
+// additionally persists the bookmark of the active RFID UID.
+func (player *Player) savePausedStateAsync() {
+	go func() {
+		player.saveBookmark()
+		err := player.SaveState()
+		if err != nil {
+			slog.Error("saving player state failed", "path", player.statePath, "err", err)
+		}
+	}()
+}
+
+// loadState restores the persisted state into the Player's tracks. It
+// returns whether the Player was playing at the time of saving. A missing
+// state file is not an error (e.g. on first start).
+func (player *Player) loadState() (bool, error) {
+	data, err := os.ReadFile(player.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no persisted player state found", "path", player.statePath)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var state playerState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return false, err
+	}
+	if state.Version != stateVersion && state.Version != 1 {
+		return false, fmt.Errorf("unsupported player state version %d (expected %d)", state.Version, stateVersion)
+	}
+
+	if state.Volume != nil {
+		player.setVolume(*state.Volume)
+	}
+
+	for _, entry := range state.Tracks {
+		track := player.findTrack(entry.Path)
+		if track == nil {
+			slog.Warn("player state: track does not exist (anymore)", "path", entry.Path)
+			continue
+		}
+		position := entry.Position
+		if state.Version == 1 {
+			position = track.legacyPosition(int64(entry.Position))
+		}
+		if !track.SetPosition(position) {
+			slog.Warn("player state: invalid position", "track", track.String(), "position", position)
+			continue
+		}
+		// a track which was playing at the time of saving has to be
+		// continued as well, hence treat it as paused
+		track.paused = entry.Paused || position > 0
+	}
+
+	current := player.findTrack(state.Current)
+	if current == nil {
+		return false, nil
+	}
+	if state.Scope != "" && current.DirnameFull() == state.Scope {
+		player.setScope(state.Scope)
+	}
+	player.setCurrent(current)
+	player.setActiveUid(state.RfidUid)
+
+	player.stateMutex.Lock()
+	player.savedState = data
+	player.stateMutex.Unlock()
+
+	slog.Info("restored player state", "path", player.statePath, "current", current.String(), "playing", state.Playing)
+	return state.Playing, nil
+}
+
+// runStateSaver periodically saves the Player's state and the bookmark of the
+// active RFID UID.
+func (player *Player) runStateSaver() {
+	ticker := time.NewTicker(STATE_SAVE_PERIOD)
+	for range ticker.C {
+		player.saveBookmark()
+		err := player.SaveState()
+		if err != nil {
+			slog.Error("periodically saving player state failed", "path", player.statePath, "err", err)
+		}
+	}
+}
+
+// Shutdown persists the Player's state and the bookmark of the active RFID
+// UID, stops the playback and closes the audio sink. It is meant to be called
+// right before the process exits or the device reboots.
+func (player *Player) Shutdown() {
+	player.saveBookmark()
+	err := player.SaveState()
+	if err != nil {
+		slog.Error("saving player state on shutdown failed", "path", player.statePath, "err", err)
+	}
+
+	player.commandMutex.Lock()
+	defer player.commandMutex.Unlock()
+
+	if player.cancelCauseFunc != nil {
+		player.cancelCauseFunc(cancelReasonShutdown)
+	}
+	player.waitStopped()
+	err = player.closeSink()
+	if err != nil {
+		slog.Error("closing audio sink on shutdown failed", "err", err)
+	}
+}
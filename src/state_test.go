@@ -0,0 +1,84 @@
+package godible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlayerStatePersistence(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	p := newTestPlayer(t, "/a.wav", "/b.wav", "/c.wav")
+	p.statePath = statePath
+	a := p.findTrack("/a.wav")
+	a.position = 100 * time.Millisecond
+	a.paused = true
+	b := p.findTrack("/b.wav")
+	b.position = 200 * time.Millisecond
+	p.setCurrent(b)
+	p.playing = true
+	err := p.SaveState()
+	if err != nil {
+		t.Fatalf("SaveState failed: %+v", err)
+	}
+
+	restored := newTestPlayer(t, "/a.wav", "/b.wav", "/c.wav")
+	restored.statePath = statePath
+	playing, err := restored.loadState()
+	if err != nil {
+		t.Fatalf("loadState failed: %+v", err)
+	}
+	if !playing {
+		t.Errorf("expected restored player state to be playing")
+	}
+	if current := restored.getCurrent(); current == nil || current.Path != "/b.wav" {
+		t.Errorf("expected current track /b.wav, got %s", current.String())
+	}
+	for path, position := range map[string]time.Duration{"/a.wav": 100 * time.Millisecond, "/b.wav": 200 * time.Millisecond, "/c.wav": 0} {
+		track := restored.findTrack(path)
+		if track.position != position {
+			t.Errorf("expected position %s for %s, got %s", position, path, track.position)
+		}
+		if track.paused != (position > 0) {
+			t.Errorf("expected paused %t for %s, got %t", position > 0, path, track.paused)
+		}
+	}
+}
+
+func TestPlayerStateMissingFile(t *testing.T) {
+	p := newTestPlayer(t, "/a.wav", "/b.wav", "/c.wav")
+	p.statePath = filepath.Join(t.TempDir(), "state.json")
+	playing, err := p.loadState()
+	if err != nil {
+		t.Fatalf("loadState failed: %+v", err)
+	}
+	if playing {
+		t.Errorf("expected a missing state file to not be playing")
+	}
+}
+
+func TestPlayerStateVersion1(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	// version 1 stored WAV positions as file offsets
+	err := os.WriteFile(statePath, []byte(`{
+		"version": 1,
+		"current": "/a.wav",
+		"playing": false,
+		"tracks": [{"path": "/a.wav", "position": 64044, "paused": true}]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newTestPlayer(t, "/a.wav", "/b.wav", "/c.wav")
+	p.statePath = statePath
+	_, err = p.loadState()
+	if err != nil {
+		t.Fatalf("loadState failed: %+v", err)
+	}
+	if track := p.findTrack("/a.wav"); track.position != 2*time.Second {
+		t.Errorf("expected position 2s, got %s", track.position)
+	}
+}
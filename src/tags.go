@@ -0,0 +1,418 @@
+package godible
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tags holds the descriptive metadata of an audio file, as stored in its ID3
+// tags, Vorbis comments or WAV INFO chunk. Unknown fields are empty or 0.
+type Tags struct {
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	TrackNumber int    `json:"track_number,omitempty"`
+	DiscNumber  int    `json:"disc_number,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+}
+
+// merge fills the empty fields of tags with the ones of other.
+func (tags *Tags) merge(other Tags) {
+	if tags.Title == "" {
+		tags.Title = other.Title
+	}
+	if tags.Artist == "" {
+		tags.Artist = other.Artist
+	}
+	if tags.Album == "" {
+		tags.Album = other.Album
+	}
+	if tags.TrackNumber == 0 {
+		tags.TrackNumber = other.TrackNumber
+	}
+	if tags.DiscNumber == 0 {
+		tags.DiscNumber = other.DiscNumber
+	}
+	if tags.Year == 0 {
+		tags.Year = other.Year
+	}
+	if tags.Genre == "" {
+		tags.Genre = other.Genre
+	}
+}
+
+// set assigns value to the field identified by one of the keys used by the
+// tag formats. Fields already set are kept, as the first value wins.
+func (tags *Tags) set(field string, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if value == "" {
+		return
+	}
+	var other Tags
+	switch field {
+	case "title":
+		other.Title = value
+	case "artist":
+		other.Artist = value
+	case "album":
+		other.Album = value
+	case "track":
+		other.TrackNumber = leadingNumber(value)
+	case "disc":
+		other.DiscNumber = leadingNumber(value)
+	case "year":
+		other.Year = leadingNumber(value)
+	case "genre":
+		other.Genre = genreName(value)
+	}
+	tags.merge(other)
+}
+
+// leadingNumber parses the number at the beginning of s, e.g. 3 of "3/12"
+// or 2001 of "2001-05-01". It returns 0, if there is no such number.
+func leadingNumber(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// id3v1Genres are the genres referenced by number in ID3v1 and ID3v2 tags.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"AlternRock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock",
+}
+
+// genreName resolves the numeric genre references of ID3 tags, i.e. "17" or
+// "(17)"; all other genres are returned as they are.
+func genreName(genre string) string {
+	number := strings.TrimSuffix(strings.TrimPrefix(genre, "("), ")")
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 || n >= len(id3v1Genres) {
+		return genre
+	}
+	return id3v1Genres[n]
+}
+
+// vorbisCommentFields maps the (upper case) Vorbis comment field names to the
+// Tags fields.
+var vorbisCommentFields = map[string]string{
+	"TITLE":       "title",
+	"ARTIST":      "artist",
+	"ALBUM":       "album",
+	"TRACKNUMBER": "track",
+	"DISCNUMBER":  "disc",
+	"DATE":        "year",
+	"GENRE":       "genre",
+}
+
+// vorbisCommentTags parses Vorbis comments of the form "NAME=value", as
+// used by Ogg Vorbis and FLAC.
+func vorbisCommentTags(comments []string) Tags {
+	var tags Tags
+	for _, comment := range comments {
+		name, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		tags.set(vorbisCommentFields[strings.ToUpper(name)], value)
+	}
+	return tags
+}
+
+// wavInfoFields maps the WAV LIST/INFO chunk IDs to the Tags fields.
+var wavInfoFields = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"IPRD": "album",
+	"ITRK": "track",
+	"IPRT": "track",
+	"ICRD": "year",
+	"IGNR": "genre",
+}
+
+// WAV_LIST_MAX_SIZE limits the size of the LIST chunks read by wavTags, so
+// that corrupt chunk sizes do not exhaust the memory; INFO chunks are small.
+const WAV_LIST_MAX_SIZE = 1 << 20
+
+// wavTags parses the LIST/INFO chunk of a RIFF/WAVE file.
+func wavTags(r io.ReaderAt) Tags {
+	var tags Tags
+	header := make([]byte, 12)
+	_, err := r.ReadAt(header, 0)
+	if err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return tags
+	}
+	riffEnd := 8 + int64(binary.LittleEndian.Uint32(header[4:]))
+	chunkHeader := make([]byte, 8)
+	for offset := int64(12); offset+8 <= riffEnd; {
+		_, err := r.ReadAt(chunkHeader, offset)
+		if err != nil {
+			break
+		}
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		if string(chunkHeader[:4]) == "LIST" && size >= 4 && size <= WAV_LIST_MAX_SIZE && offset+8+size <= riffEnd {
+			data := make([]byte, size)
+			_, err = r.ReadAt(data, offset+8)
+			if err != nil {
+				break
+			}
+			if string(data[:4]) == "INFO" {
+				tags.merge(wavInfoTags(data[4:]))
+			}
+		}
+		// chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+	return tags
+}
+
+func wavInfoTags(data []byte) Tags {
+	var tags Tags
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:]))
+		data = data[8:]
+		if size > len(data) {
+			break
+		}
+		tags.set(wavInfoFields[id], string(data[:size]))
+		data = data[min(size+size%2, len(data)):]
+	}
+	return tags
+}
+
+// id3Tags parses the ID3v2 tag at the beginning and the ID3v1 tag at the end
+// of an MP3 file of the given size. ID3v2 takes precedence.
+func id3Tags(r io.ReaderAt, size int64) Tags {
+	tags := id3v2Tags(r, size)
+	tags.merge(id3v1Tags(r, size))
+	return tags
+}
+
+// id3v1Tags parses the ID3v1(.1) tag in the last 128 bytes of a file.
+func id3v1Tags(r io.ReaderAt, size int64) Tags {
+	var tags Tags
+	if size < 128 {
+		return tags
+	}
+	data := make([]byte, 128)
+	_, err := r.ReadAt(data, size-128)
+	if err != nil || string(data[:3]) != "TAG" {
+		return tags
+	}
+	tags.set("title", latin1(data[3:33]))
+	tags.set("artist", latin1(data[33:63]))
+	tags.set("album", latin1(data[63:93]))
+	tags.set("year", latin1(data[93:97]))
+	// ID3v1.1 stores the track number at the end of the comment
+	if data[125] == 0 && data[126] != 0 {
+		tags.TrackNumber = int(data[126])
+	}
+	if int(data[127]) < len(id3v1Genres) {
+		tags.Genre = id3v1Genres[data[127]]
+	}
+	return tags
+}
+
+// id3v2Fields maps the ID3v2.2 (3 characters) and ID3v2.3/ID3v2.4 (4
+// characters) frame IDs to the Tags fields.
+var id3v2Fields = map[string]string{
+	"TT2": "title", "TIT2": "title",
+	"TP1": "artist", "TPE1": "artist",
+	"TAL": "album", "TALB": "album",
+	"TRK": "track", "TRCK": "track",
+	"TPA": "disc", "TPOS": "disc",
+	"TYE": "year", "TYER": "year", "TDRC": "year",
+	"TCO": "genre", "TCON": "genre",
+}
+
+// syncsafe decodes a 28bit integer stored in 4 bytes of 7 bits each.
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// deunsynchronise reverts the ID3v2 unsynchronisation, which inserts a zero
+// byte after every 0xff.
+func deunsynchronise(data []byte) []byte {
+	return bytes.ReplaceAll(data, []byte{0xff, 0x00}, []byte{0xff})
+}
+
+// ID3V2_MAX_SIZE limits the size of the ID3v2 tags read by id3v2Tags, so that
+// corrupt tag sizes do not exhaust the memory.
+const ID3V2_MAX_SIZE = 1 << 20
+
+// id3v2Tags parses the text frames of an ID3v2.2, ID3v2.3 or ID3v2.4 tag at
+// the beginning of a file of the given size.
+func id3v2Tags(r io.ReaderAt, fileSize int64) Tags {
+	var tags Tags
+	header := make([]byte, 10)
+	_, err := r.ReadAt(header, 0)
+	if err != nil || string(header[:3]) != "ID3" {
+		return tags
+	}
+	version := header[3]
+	flags := header[5]
+	if version < 2 || version > 4 {
+		return tags
+	}
+	size := syncsafe(header[6:])
+	if size > ID3V2_MAX_SIZE || int64(size) > fileSize-10 {
+		return tags
+	}
+	data := make([]byte, size)
+	_, err = r.ReadAt(data, 10)
+	if err != nil {
+		return tags
+	}
+	// ID3v2.4 unsynchronises the frames individually
+	if flags&0x80 != 0 && version < 4 {
+		data = deunsynchronise(data)
+	}
+	if flags&0x40 != 0 && version > 2 && len(data) >= 4 {
+		// skip the extended header
+		size := int(binary.BigEndian.Uint32(data)) + 4
+		if version == 4 {
+			size = syncsafe(data)
+		}
+		data = data[min(size, len(data)):]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		id := string(data[:idSize])
+		var size int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(data[4:]))
+			frameFlags = binary.BigEndian.Uint16(data[8:])
+		default:
+			size = syncsafe(data[4:])
+			frameFlags = binary.BigEndian.Uint16(data[8:])
+		}
+		data = data[headerSize:]
+		if size > len(data) {
+			break
+		}
+		frame := data[:size]
+		data = data[size:]
+
+		field, ok := id3v2Fields[id]
+		if !ok {
+			continue
+		}
+		frame, ok = id3v2FrameContent(version, frameFlags, frame)
+		if !ok || len(frame) == 0 {
+			continue
+		}
+		tags.set(field, id3v2Text(frame[0], frame[1:]))
+	}
+	return tags
+}
+
+// id3v2FrameContent strips the additional data indicated by a frame's flags.
+// It returns false for compressed or encrypted frames.
+func id3v2FrameContent(version byte, flags uint16, frame []byte) ([]byte, bool) {
+	switch version {
+	case 3:
+		if flags&0x00c0 != 0 {
+			return nil, false
+		}
+		if flags&0x0020 != 0 && len(frame) > 0 {
+			// group identifier
+			frame = frame[1:]
+		}
+	case 4:
+		if flags&0x000c != 0 {
+			return nil, false
+		}
+		if flags&0x0040 != 0 && len(frame) > 0 {
+			// group identifier
+			frame = frame[1:]
+		}
+		if flags&0x0001 != 0 && len(frame) >= 4 {
+			// data length indicator
+			frame = frame[4:]
+		}
+		if flags&0x0002 != 0 {
+			frame = deunsynchronise(frame)
+		}
+	}
+	return frame, true
+}
+
+// id3v2Text decodes the text of an ID3v2 text frame with the given encoding.
+// Only the first of multiple (ID3v2.4) values is returned.
+func id3v2Text(encoding byte, text []byte) string {
+	switch encoding {
+	case 1, 2:
+		// UTF-16 with byte order mark, or UTF-16BE without it
+		bigEndian := encoding == 2
+		if len(text) >= 2 && text[0] == 0xfe && text[1] == 0xff {
+			bigEndian = true
+			text = text[2:]
+		} else if len(text) >= 2 && text[0] == 0xff && text[1] == 0xfe {
+			text = text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			var unit uint16
+			if bigEndian {
+				unit = binary.BigEndian.Uint16(text[i:])
+			} else {
+				unit = binary.LittleEndian.Uint16(text[i:])
+			}
+			if unit == 0 {
+				break
+			}
+			units = append(units, unit)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		value, _, _ := strings.Cut(string(text), "\x00")
+		return value
+	default:
+		value, _, _ := bytes.Cut(text, []byte{0})
+		return latin1(value)
+	}
+}
+
+// latin1 decodes ISO-8859-1 text, stopping at the first zero byte.
+func latin1(text []byte) string {
+	runes := make([]rune, 0, len(text))
+	for _, b := range text {
+		if b == 0 {
+			break
+		}
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
@@ -0,0 +1,168 @@
+package godible
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// id3v2Frame encodes an ID3v2.3 (or ID3v2.4, if syncsafe) text frame.
+func id3v2Frame(id string, encoding byte, text []byte, syncsafeSize bool) []byte {
+	size := uint32(len(text) + 1)
+	if syncsafeSize {
+		size = (size & 0x7f) | (size&0x3f80)<<1
+	}
+	frame := []byte(id)
+	frame = binary.BigEndian.AppendUint32(frame, size)
+	frame = append(frame, 0, 0, encoding)
+	return append(frame, text...)
+}
+
+func id3v2Tag(version byte, frames ...[]byte) []byte {
+	data := bytes.Join(frames, nil)
+	size := len(data)
+	tag := []byte{'I', 'D', '3', version, 0, 0}
+	return append(append(tag, byte(size>>21&0x7f), byte(size>>14&0x7f), byte(size>>7&0x7f), byte(size&0x7f)), data...)
+}
+
+func utf16WithBOM(s string) []byte {
+	text := []byte{0xff, 0xfe}
+	for _, unit := range utf16.Encode([]rune(s)) {
+		text = binary.LittleEndian.AppendUint16(text, unit)
+	}
+	return text
+}
+
+func TestId3Tags(t *testing.T) {
+	tag := id3v2Tag(3,
+		id3v2Frame("TIT2", 1, utf16WithBOM("Kapitel 1: Der Räuber"), false),
+		id3v2Frame("TPE1", 0, []byte("Otfried Preu\xdfler"), false),
+		id3v2Frame("TRCK", 3, []byte("3/12"), false),
+		id3v2Frame("TCON", 0, []byte("(28)"), false),
+	)
+	// the ID3v1 tag provides the fields missing in the ID3v2 tag
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+	copy(id3v1[3:], "ignored title")
+	copy(id3v1[63:], "Der Raeuber Hotzenplotz")
+	copy(id3v1[93:], "1962")
+	id3v1[126] = 7
+	id3v1[127] = 255
+	data := append(append(tag, make([]byte, 64)...), id3v1...)
+
+	tags := id3Tags(bytes.NewReader(data), int64(len(data)))
+	expected := Tags{
+		Title:       "Kapitel 1: Der Räuber",
+		Artist:      "Otfried Preußler",
+		Album:       "Der Raeuber Hotzenplotz",
+		TrackNumber: 3,
+		Year:        1962,
+		Genre:       "Vocal",
+	}
+	if tags != expected {
+		t.Errorf("expected %+v, got %+v", expected, tags)
+	}
+}
+
+func TestId3v24Tags(t *testing.T) {
+	title := bytes.Repeat([]byte("x"), 200)
+	tag := id3v2Tag(4,
+		id3v2Frame("TIT2", 3, title, true),
+		id3v2Frame("TDRC", 3, []byte("2001-05-01"), true),
+		id3v2Frame("TPOS", 3, []byte("2"), true),
+	)
+	tags := id3Tags(bytes.NewReader(tag), int64(len(tag)))
+	expected := Tags{Title: string(title), Year: 2001, DiscNumber: 2}
+	if tags != expected {
+		t.Errorf("expected %+v, got %+v", expected, tags)
+	}
+
+	// corrupt sizes exceeding the file or ID3V2_MAX_SIZE skip the tag,
+	// instead of allocating it
+	for _, test := range []struct {
+		size     int
+		fileSize int64
+	}{
+		{len(tag), int64(len(tag))},
+		{ID3V2_MAX_SIZE + 1, 1 << 30},
+		{0x0fffffff, 1 << 30},
+	} {
+		corrupt := bytes.Clone(tag)
+		copy(corrupt[6:], []byte{byte(test.size >> 21 & 0x7f), byte(test.size >> 14 & 0x7f), byte(test.size >> 7 & 0x7f), byte(test.size & 0x7f)})
+		r := limitedReaderAt{Reader: bytes.NewReader(corrupt), t: t}
+		if tags := id3Tags(r, test.fileSize); tags != (Tags{}) {
+			t.Errorf("size %d: expected no tags, got %+v", test.size, tags)
+		}
+	}
+}
+
+// limitedReaderAt fails the test on reads exceeding ID3V2_MAX_SIZE.
+type limitedReaderAt struct {
+	*bytes.Reader
+	t *testing.T
+}
+
+func (r limitedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > ID3V2_MAX_SIZE {
+		r.t.Errorf("unexpected read of %d bytes", len(p))
+	}
+	return r.Reader.ReadAt(p, off)
+}
+
+func TestVorbisCommentTags(t *testing.T) {
+	tags := vorbisCommentTags([]string{
+		"title=Momo",
+		"ARTIST=Michael Ende",
+		"Album=Momo",
+		"TRACKNUMBER=04",
+		"DATE=1973-01-01",
+		"GENRE=Hörbuch",
+		"GENRE=ignored",
+		"invalid",
+	})
+	expected := Tags{Title: "Momo", Artist: "Michael Ende", Album: "Momo", TrackNumber: 4, Year: 1973, Genre: "Hörbuch"}
+	if tags != expected {
+		t.Errorf("expected %+v, got %+v", expected, tags)
+	}
+}
+
+func TestWavTags(t *testing.T) {
+	info := []byte("INFO")
+	for _, chunk := range [][2]string{{"INAM", "Titel\x00"}, {"IART", "Interpret"}, {"ITRK", "5"}} {
+		info = append(info, chunk[0]...)
+		info = binary.LittleEndian.AppendUint32(info, uint32(len(chunk[1])))
+		info = append(info, chunk[1]...)
+		if len(chunk[1])%2 == 1 {
+			info = append(info, 0)
+		}
+	}
+	var chunks []byte
+	chunks = append(chunks, "data"...)
+	chunks = binary.LittleEndian.AppendUint32(chunks, 3)
+	chunks = append(chunks, 1, 2, 3, 0)
+	chunks = append(chunks, "LIST"...)
+	chunks = binary.LittleEndian.AppendUint32(chunks, uint32(len(info)))
+	chunks = append(chunks, info...)
+	data := []byte("RIFF")
+	data = binary.LittleEndian.AppendUint32(data, uint32(4+len(chunks)))
+	data = append(append(data, "WAVE"...), chunks...)
+
+	tags := wavTags(bytes.NewReader(data))
+	expected := Tags{Title: "Titel", Artist: "Interpret", TrackNumber: 5}
+	if tags != expected {
+		t.Errorf("expected %+v, got %+v", expected, tags)
+	}
+
+	// corrupt chunk sizes are not trusted
+	for _, size := range []uint32{0xfffffff0, WAV_LIST_MAX_SIZE + 2} {
+		corrupt := []byte("RIFF")
+		corrupt = binary.LittleEndian.AppendUint32(corrupt, 0xfffffff0)
+		corrupt = append(corrupt, "WAVELIST"...)
+		corrupt = binary.LittleEndian.AppendUint32(corrupt, size)
+		corrupt = append(corrupt, info...)
+		if tags := wavTags(bytes.NewReader(corrupt)); tags != (Tags{}) {
+			t.Errorf("expected no tags of a LIST chunk of size %d, got %+v", size, tags)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package godible
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	TLS_CERT_FILE = DATADIR + "cert.pem"
+	TLS_KEY_FILE  = DATADIR + "key.pem"
+	// TLS_CERT_VALIDITY is the validity of the generated certificate; it is
+	// regenerated once it expired
+	TLS_CERT_VALIDITY = 10 * 365 * 24 * time.Hour
+)
+
+// loadOrCreateCertificate loads the certificate and its key from the given
+// PEM files. If they do not exist (yet) or the certificate expired, a
+// self-signed certificate is generated and persisted instead.
+func loadOrCreateCertificate(certPath string, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && time.Now().Before(cert.Leaf.NotAfter) {
+		slog.Info("loaded tls certificate", "path", certPath, "expires", cert.Leaf.NotAfter)
+		return cert, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return tls.Certificate{}, err
+	}
+
+	certPEM, keyPEM, err := generateCertificate(time.Now())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = writePermFileMode(keyPath, keyPEM, 0600)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	err = writePermFile(certPath, certPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	slog.Info("generated self-signed tls certificate", "path", certPath)
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateCertificate returns a new self-signed certificate and its key as
+// PEM. It is valid for the hostname, localhost and the addresses of the
+// network interfaces.
+func generateCertificate(notBefore time.Time) (certPEM []byte, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "godible"
+	}
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"godible"}, CommonName: hostname},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(TLS_CERT_VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{hostname, "localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		slog.Warn("listing the interface addresses failed", "err", err)
+	}
+	for _, address := range addresses {
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ipnet.IP)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating certificate failed: %w", err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	return certPEM, keyPEM, nil
+}
+
+// httpsRedirectHandler redirects all requests to the HTTPS listener at
+// tlsAddress, keeping the requested host name. The redirect is temporary, so
+// that browsers do not cache it once HTTPS gets disabled again.
+func httpsRedirectHandler(tlsAddress string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(tlsAddress)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}
+}
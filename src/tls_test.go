@@ -0,0 +1,56 @@
+package godible
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	created, err := loadOrCreateCertificate(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileinfo, err := os.Stat(keyPath)
+	if err != nil || fileinfo.Mode().Perm() != 0600 {
+		t.Errorf("expected a private key file, got %v (%v)", fileinfo, err)
+	}
+	if !isDataFile(certPath) || !isDataFile(keyPath+".tmp") {
+		t.Errorf("expected the certificate files to be data files")
+	}
+
+	loaded, err := loadOrCreateCertificate(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Certificate[0], created.Certificate[0]) {
+		t.Errorf("expected the persisted certificate to be loaded")
+	}
+}
+
+func TestHttpsRedirectHandler(t *testing.T) {
+	for _, test := range []struct {
+		tlsAddress string
+		host       string
+		expected   string
+	}{
+		{":1443", "godible:1234", "https://godible:1443/api/v1/state?a=b"},
+		{":443", "10.0.0.225:1234", "https://10.0.0.225/api/v1/state?a=b"},
+		{"0.0.0.0:443", "godible", "https://godible/api/v1/state?a=b"},
+		{":1443", "[::1]", "https://[::1]:1443/api/v1/state?a=b"},
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/api/v1/state?a=b", nil)
+		request.Host = test.host
+		httpsRedirectHandler(test.tlsAddress)(recorder, request)
+		if recorder.Code != http.StatusTemporaryRedirect || recorder.Header().Get("Location") != test.expected {
+			t.Errorf("%s via %s: expected a redirect to %s, got %d %s", test.host, test.tlsAddress, test.expected, recorder.Code, recorder.Header().Get("Location"))
+		}
+	}
+}
@@ -3,46 +3,81 @@ package godible
 import (
 	"container/list"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type Track struct {
-	Path     string
-	position int64
-	length   int64
-	duration int64
+	Path string
+	// position is the offset from the Track's beginning to continue at
+	position time.Duration
+	duration time.Duration
 	metadata *Metadata
 	paused   bool
 }
 
-func (t *Track) SetPosition(pos int64) int64 {
-	if t == nil {
-		return -1
-	}
-	if pos > t.length {
-		return -1
+// SetPosition sets the offset from the Track's beginning to continue at. It
+// returns false, if the position lies outside of the Track.
+func (t *Track) SetPosition(pos time.Duration) bool {
+	if t == nil || pos < 0 || pos > t.duration {
+		return false
 	}
 	t.position = pos
-	return t.position
+	return true
+}
+
+// legacyPosition converts a position of the persisted formats' version 1,
+// which was given in units of the respective TrackReader, into the offset
+// from the Track's beginning.
+func (t *Track) legacyPosition(position int64) time.Duration {
+	if t.metadata == nil {
+		return 0
+	}
+	var frames int64
+	switch t.metadata.audioFormat {
+	case MP3:
+		// bytes of 16bit stereo PCM data
+		frames = position / mp3FrameSize
+	case OGG, FLAC:
+		frames = position
+	default:
+		// file offsets; assume the canonical WAV header
+		frameSize := int64(t.metadata.channelNum * t.metadata.bytesPerSample)
+		if frameSize == 0 {
+			return 0
+		}
+		frames = max(0, position-wavHeaderSize) / frameSize
+	}
+	return min(framesToDuration(frames, t.metadata.sampleRate), t.duration)
 }
 
 func (t *Track) String() string {
 	if t == nil {
 		return "nil"
 	}
-	return fmt.Sprintf("Track{path: %s, position: %d, length: %d}", t.Path, t.position, t.length)
+	return fmt.Sprintf("Track{path: %s, position: %s, duration: %s}", t.Path, t.position, t.duration)
 }
 
 func (t *Track) CurrentSeconds() int64 {
-	if t.length == 0 {
-		return 0
+	return int64(t.position.Seconds())
+}
+
+// DurationSeconds returns the Track's duration in whole seconds.
+func (t *Track) DurationSeconds() int64 {
+	return int64(t.duration.Seconds())
+}
+
+// Tags returns the Track's tags (e.g. title and artist).
+func (t *Track) Tags() Tags {
+	if t.metadata == nil {
+		return Tags{}
 	}
-	var tmp float64 = float64(t.position) / float64(t.length)
-	tmp = tmp * float64(t.duration)
-	return int64(tmp)
+	return t.metadata.tags
 }
 
 func (t *Track) Basename() string {
@@ -51,7 +86,11 @@ func (t *Track) Basename() string {
 }
 
 func (t *Track) DirnameShow() string {
-	dir := t.DirnameFull()
+	return dirnameShow(t.DirnameFull())
+}
+
+// dirnameShow returns the given directory relative to DATADIR.
+func dirnameShow(dir string) string {
 	dir_without_datadir := strings.TrimPrefix(dir, strings.TrimSuffix(DATADIR, "/"))
 	if strings.HasPrefix(dir_without_datadir, "/") {
 		return dir_without_datadir
@@ -71,6 +110,15 @@ func isRegularFile(path string) (bool, error) {
 	return fileinfo.Mode().IsRegular(), nil
 }
 
+// isDataFile reports whether path is one of godible's own data files (e.g.
+// the persisted RFID mappings or the TLS certificate), which are stored
+// alongside the audio files. The temporary files written by writePermFile
+// are data files as well.
+func isDataFile(path string) bool {
+	ext := filepath.Ext(strings.TrimSuffix(path, ".tmp"))
+	return ext == ".json" || ext == ".pem"
+}
+
 func NewTrack(path string) (*Track, error) {
 	ok, err := isRegularFile(path)
 	if err != nil {
@@ -91,24 +139,76 @@ func NewTrack(path string) (*Track, error) {
 
 	reader, err := NewTrackReader(&t)
 	if err == nil {
-		t.length, err = reader.Length()
 		t.duration, err = reader.Duration()
+		if err != nil {
+			slog.Error("failed to gather track's duration", "path", path, "err", err)
+		}
 		reader.Close()
 	} else {
-		slog.Error("failed to gather track's length", "err", err)
+		slog.Error("failed to gather track's duration", "err", err)
 	}
 
 	return &t, nil
 }
 
+// newIndexedTrack returns the Track of path from the TrackIndex, or probes
+// it via NewTrack and stores it in the index.
+func newIndexedTrack(path string, direntry os.DirEntry, idx *TrackIndex) (*Track, error) {
+	if idx == nil {
+		return NewTrack(path)
+	}
+	fileinfo, err := direntry.Info()
+	if err != nil {
+		return nil, err
+	}
+	t := idx.lookup(path, fileinfo)
+	if t != nil {
+		return t, nil
+	}
+	t, err = NewTrack(path)
+	if err != nil {
+		return nil, err
+	}
+	idx.store(t, fileinfo)
+	return t, nil
+}
+
 // Creates a list of Tracks for all regular files within the given root
 // directory and its subdirectories of any level.
 //
 // The function returns any occuring error immediately.
 func CreateTrackList(tl *list.List, root string) error {
+	return CreateIndexedTrackList(tl, root, nil)
+}
+
+// CreateIndexedTrackList works like CreateTrackList, but takes the Tracks of
+// unchanged files from the given TrackIndex. New or changed files are probed
+// and stored in the index. The index may be nil.
+func CreateIndexedTrackList(tl *list.List, root string, idx *TrackIndex) error {
+	return scanTrackList(tl, root, idx, nil)
+}
+
+// ScanProgress counts the files handled by a scan of the library. It is
+// updated by the scan while being read, e.g. by the web interface.
+type ScanProgress struct {
+	// Scanned is the number of files handled so far, including the
+	// skipped and failed ones
+	Scanned atomic.Int64
+	// Skipped is the number of hidden, data and unsupported files
+	Skipped atomic.Int64
+	// Errors is the number of files which could not be probed
+	Errors atomic.Int64
+}
+
+// scanTrackList works like CreateIndexedTrackList and additionally counts
+// the handled files in progress, which may be nil.
+func scanTrackList(tl *list.List, root string, idx *TrackIndex, progress *ScanProgress) error {
 	if tl == nil {
 		tl = list.New()
 	}
+	if progress == nil {
+		progress = &ScanProgress{}
+	}
 	fileinfo, err := os.Stat(root)
 	if err != nil {
 		return err
@@ -121,22 +221,36 @@ func CreateTrackList(tl *list.List, root string) error {
 		return err
 	}
 	for _, direntry := range direntries {
-		path := root + "/" + direntry.Name()
+		path := filepath.Join(root, direntry.Name())
+		if isHidden(path) {
+			if !direntry.IsDir() {
+				progress.Scanned.Add(1)
+				progress.Skipped.Add(1)
+			}
+			continue
+		}
 		if direntry.IsDir() {
-			err := CreateTrackList(tl, path)
+			err := scanTrackList(tl, path, idx, progress)
 			if err != nil {
 				return err
 			}
 			continue
 		}
 		if direntry.Type().IsRegular() {
-			t, err := NewTrack(path)
+			progress.Scanned.Add(1)
+			if isDataFile(path) {
+				progress.Skipped.Add(1)
+				continue
+			}
+			t, err := newIndexedTrack(path, direntry, idx)
 			if err != nil {
 				slog.Error("skip track", "path", path, "error", err)
+				progress.Errors.Add(1)
 				continue
 			}
 			if !sampleRateSupported(t.metadata.sampleRate) {
 				slog.Error("skip track: unsupported sample rate", "path", t.Path, "sample rate", t.metadata.sampleRate)
+				progress.Skipped.Add(1)
 				continue
 			}
 			tl.PushBack(t)
@@ -146,6 +260,28 @@ func CreateTrackList(tl *list.List, root string) error {
 	return nil
 }
 
+// countFiles returns the number of regular files within root and its
+// (non-hidden) subdirectories, i.e. the number of files a scan handles.
+func countFiles(root string) (int64, error) {
+	var count int64
+	err := filepath.WalkDir(root, func(path string, direntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if direntry.IsDir() {
+			if path != root && isHidden(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if direntry.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
 // TODO func TrackListContainsTrackPath(tl *list.List, tp string) bool
 // TODO func TrackListContainsTrack(tl *list.List, t *Track) bool
 // TODO func TrackListContainsElement(tl *list.List, e *list.Element) bool
@@ -117,3 +117,64 @@ func TestExoticPaths(t *testing.T) {
 		t.Errorf("expected Path to be %s, is %s", expectedPath, isPath)
 	}
 }
+
+func TestIndexedFileList(t *testing.T) {
+	tmpBaseDir := t.TempDir()
+	indexPath := filepath.Join(t.TempDir(), "tracks.json")
+	for _, name := range []string{"/f0.wav", "/f1.wav", "/f2.wav"} {
+		err := os.WriteFile(tmpBaseDir+name, minimalWavFile(t), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx := LoadTrackIndex(indexPath)
+	err := CreateIndexedTrackList(list.New(), tmpBaseDir, idx)
+	if err != nil {
+		t.Fatalf("CreateIndexedTrackList failed: %+v", err)
+	}
+	idx.prune()
+	err = idx.Save()
+	if err != nil {
+		t.Fatalf("Save failed: %+v", err)
+	}
+
+	// mark the entries, to tell cached from probed tracks
+	idx = LoadTrackIndex(indexPath)
+	if len(idx.entries) != 3 {
+		t.Fatalf("expected 3 index entries; got %d", len(idx.entries))
+	}
+	for path, entry := range idx.entries {
+		entry.Duration = 42
+		idx.entries[path] = entry
+	}
+	// change f1, remove f2
+	err = os.WriteFile(tmpBaseDir+"/f1.wav", append(minimalWavFile(t), 0, 0), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(tmpBaseDir + "/f2.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileList := list.New()
+	err = CreateIndexedTrackList(fileList, tmpBaseDir, idx)
+	if err != nil {
+		t.Fatalf("CreateIndexedTrackList failed: %+v", err)
+	}
+	idx.prune()
+	if fileList.Len() != 2 {
+		t.Fatalf("expected list with 2 entries; got %d", fileList.Len())
+	}
+	for element := fileList.Front(); element != nil; element = element.Next() {
+		track := element.Value.(*Track)
+		cached := track.duration == 42
+		if expected := track.Path == tmpBaseDir+"/f0.wav"; cached != expected {
+			t.Errorf("%s: expected cached %t; got %t", track.Path, expected, cached)
+		}
+	}
+	if _, ok := idx.entries[tmpBaseDir+"/f2.wav"]; ok {
+		t.Errorf("expected index entry of removed file to be pruned")
+	}
+}
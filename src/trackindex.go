@@ -0,0 +1,206 @@
+package godible
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TRACKS_FILE = DATADIR + "tracks.json"
+	// trackIndexVersion is the current version of the TRACKS_FILE format.
+	// Bump it on incompatible changes of trackIndexEntry; an outdated index
+	// is discarded and recreated from scratch.
+	trackIndexVersion = 3
+)
+
+// trackIndexFile is the on-disk representation of a TrackIndex.
+type trackIndexFile struct {
+	Version int               `json:"version"`
+	Tracks  []trackIndexEntry `json:"tracks"`
+}
+
+// trackIndexEntry caches everything NewTrack gathers for a file. An entry is
+// valid as long as the file's size and modification time did not change.
+type trackIndexEntry struct {
+	Path           string          `json:"path"`
+	Size           int64           `json:"size"`
+	ModTime        int64           `json:"mod_time"`
+	AudioFormat    AudioFileFormat `json:"audio_format"`
+	BytesPerSample int             `json:"bytes_per_sample"`
+	SampleRate     int             `json:"sample_rate"`
+	ChannelNum     int             `json:"channel_num"`
+	// Duration is the Track's duration in nanoseconds
+	Duration time.Duration `json:"duration"`
+	Tags     Tags          `json:"tags"`
+}
+
+// TrackIndex caches the (expensive) result of NewTrack per file, so that
+// CreateIndexedTrackList only needs to probe new or changed files.
+type TrackIndex struct {
+	// mutex protects the index, as files may be renamed concurrently to
+	// the library watcher's lookups
+	mutex   sync.Mutex
+	path    string
+	entries map[string]trackIndexEntry
+	// seen contains the paths looked up or stored during the current scan
+	seen map[string]bool
+	// dirty is true, if entries differ from the content of path
+	dirty bool
+}
+
+// LoadTrackIndex reads the index stored at path. If the file is missing,
+// invalid or outdated, an empty index is returned.
+func LoadTrackIndex(path string) *TrackIndex {
+	idx := &TrackIndex{
+		path:    path,
+		entries: make(map[string]trackIndexEntry),
+		seen:    make(map[string]bool),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Info("no track index found", "path", path)
+		return idx
+	}
+	if err != nil {
+		slog.Error("reading track index failed", "path", path, "err", err)
+		return idx
+	}
+	var indexFile trackIndexFile
+	err = json.Unmarshal(data, &indexFile)
+	if err != nil {
+		slog.Error("decoding track index failed", "path", path, "err", err)
+		return idx
+	}
+	if indexFile.Version != trackIndexVersion {
+		slog.Info("discard outdated track index", "path", path, "version", indexFile.Version)
+		return idx
+	}
+	for _, entry := range indexFile.Tracks {
+		idx.entries[entry.Path] = entry
+	}
+	slog.Info("loaded track index", "path", path, "len", len(idx.entries))
+	return idx
+}
+
+// lookup returns the cached Track for path, if fileinfo still matches the
+// indexed file.
+func (idx *TrackIndex) lookup(path string, fileinfo os.FileInfo) *Track {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	entry, ok := idx.entries[path]
+	if !ok || entry.Size != fileinfo.Size() || entry.ModTime != fileinfo.ModTime().UnixNano() {
+		return nil
+	}
+	idx.seen[path] = true
+	return &Track{
+		Path: path,
+		metadata: &Metadata{
+			audioFormat:    entry.AudioFormat,
+			bytesPerSample: entry.BytesPerSample,
+			sampleRate:     entry.SampleRate,
+			channelNum:     entry.ChannelNum,
+			tags:           entry.Tags,
+		},
+		duration: entry.Duration,
+	}
+}
+
+// store adds or replaces the index entry of track.
+func (idx *TrackIndex) store(track *Track, fileinfo os.FileInfo) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.entries[track.Path] = trackIndexEntry{
+		Path:           track.Path,
+		Size:           fileinfo.Size(),
+		ModTime:        fileinfo.ModTime().UnixNano(),
+		AudioFormat:    track.metadata.audioFormat,
+		BytesPerSample: track.metadata.bytesPerSample,
+		SampleRate:     track.metadata.sampleRate,
+		ChannelNum:     track.metadata.channelNum,
+		Duration:       track.duration,
+		Tags:           track.metadata.tags,
+	}
+	idx.seen[track.Path] = true
+	idx.dirty = true
+}
+
+// rename moves the entries of the file or directory src to the respective
+// paths within dst, so that moved files do not have to be probed again.
+func (idx *TrackIndex) rename(src string, dst string) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	var moved []trackIndexEntry
+	for path, entry := range idx.entries {
+		if withinPath(path, src) {
+			delete(idx.entries, path)
+			moved = append(moved, entry)
+		}
+	}
+	for _, entry := range moved {
+		idx.seen[movedPath(entry.Path, src, dst)] = idx.seen[entry.Path]
+		entry.Path = movedPath(entry.Path, src, dst)
+		idx.entries[entry.Path] = entry
+		idx.dirty = true
+	}
+}
+
+// beginScan starts a new scan of the library: prune afterwards removes the
+// entries not looked up or stored since then.
+func (idx *TrackIndex) beginScan() {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.seen = make(map[string]bool)
+}
+
+// prune removes all entries which were not looked up or stored since the
+// index was loaded (or since beginScan), i.e. the entries of removed files.
+func (idx *TrackIndex) prune() {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	for path := range idx.entries {
+		if !idx.seen[path] {
+			slog.Debug("prune track index entry", "path", path)
+			delete(idx.entries, path)
+			idx.dirty = true
+		}
+	}
+}
+
+// Save writes the index to its path, if it changed.
+func (idx *TrackIndex) Save() error {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	if !idx.dirty {
+		return nil
+	}
+	indexFile := trackIndexFile{Version: trackIndexVersion, Tracks: []trackIndexEntry{}}
+	for _, entry := range idx.entries {
+		indexFile.Tracks = append(indexFile.Tracks, entry)
+	}
+	slices.SortFunc(indexFile.Tracks, func(a, b trackIndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	data, err := json.Marshal(indexFile)
+	if err != nil {
+		return err
+	}
+	err = writePermFile(idx.path, data)
+	if err != nil {
+		return fmt.Errorf("writing track index: %w", err)
+	}
+	idx.dirty = false
+	return nil
+}
@@ -2,57 +2,103 @@ package godible
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"os"
+	"time"
 
 	wav "github.com/go-audio/wav"
 	mp3 "github.com/hajimehoshi/go-mp3"
-	"github.com/hcl/audioduration"
 	"github.com/jfreymuth/oggvorbis"
+	"github.com/mewkiz/flac"
 )
 
+// TrackReader reads the PCM data of a Track. All positions are offsets from
+// the Track's beginning, independent of the decoder; hence they stay valid
+// if the decoder changes.
 type TrackReader interface {
 	Read(p []byte) (int, error)
-	Seek(offset int64, whence int) (int64, error)
+	// Seek moves to the frame at the given offset from the Track's
+	// beginning. Offsets behind the Track's end move to its end.
+	Seek(offset time.Duration) error
 	Close() error
-	Position() (int64, error)
-	Length() (int64, error)
-	Duration() (int64, error)
+	// Position returns the offset of the next frame to be read.
+	Position() (time.Duration, error)
+	Duration() (time.Duration, error)
 }
 
+// framesToDuration converts a number of frames into the time they take to
+// play at the given sample rate.
+func framesToDuration(frames int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	seconds := frames / int64(sampleRate)
+	rest := frames % int64(sampleRate)
+	return time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(sampleRate)
+}
+
+// durationToFrames converts a duration into the number of frames played
+// within it at the given sample rate. Negative durations map to 0.
+func durationToFrames(d time.Duration, sampleRate int) int64 {
+	d = max(0, d)
+	seconds := int64(d / time.Second)
+	rest := int64(d % time.Second)
+	return seconds*int64(sampleRate) + rest*int64(sampleRate)/int64(time.Second)
+}
+
+// WavReader reads the PCM data of a WAV file.
 type WavReader struct {
 	file    *os.File
 	decoder *wav.Decoder
+	// pcmStart and pcmEnd are the file offsets of the PCM data
+	pcmStart int64
+	pcmEnd   int64
+}
+
+func (w WavReader) frameSize() int64 {
+	return int64(w.decoder.NumChans) * int64(w.decoder.BitDepth/8)
 }
 
 func (w WavReader) Read(p []byte) (n int, err error) {
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if offset >= w.pcmEnd {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > w.pcmEnd-offset {
+		p = p[:w.pcmEnd-offset]
+	}
 	return w.file.Read(p)
 }
 
-func (w WavReader) Seek(offset int64, whence int) (int64, error) {
-	return w.file.Seek(offset, whence)
+func (w WavReader) Seek(offset time.Duration) error {
+	fileOffset := w.pcmStart + durationToFrames(offset, int(w.decoder.SampleRate))*w.frameSize()
+	_, err := w.file.Seek(min(fileOffset, w.pcmEnd), io.SeekStart)
+	return err
 }
 
 func (w WavReader) Close() error {
 	return w.file.Close()
 }
 
-func (w WavReader) Position() (int64, error) {
-	return w.file.Seek(0, io.SeekCurrent)
-}
-
-func (w WavReader) Length() (int64, error) {
-	fi, err := w.file.Stat()
-	if err != nil {
+func (w WavReader) Position() (time.Duration, error) {
+	offset, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil || w.frameSize() == 0 {
 		return 0, err
 	}
-	return fi.Size(), nil
+	frames := (max(offset, w.pcmStart) - w.pcmStart) / w.frameSize()
+	return framesToDuration(frames, int(w.decoder.SampleRate)), nil
 }
 
-func (w WavReader) Duration() (int64, error) {
-	ret, err := w.decoder.Duration()
-	return int64(ret.Seconds()), err
+func (w WavReader) Duration() (time.Duration, error) {
+	if w.frameSize() == 0 {
+		return 0, fmt.Errorf("wav: invalid frame size")
+	}
+	return framesToDuration((w.pcmEnd-w.pcmStart)/w.frameSize(), int(w.decoder.SampleRate)), nil
 }
 
 func wavTrackReader(track *Track) (TrackReader, error) {
@@ -61,12 +107,28 @@ func wavTrackReader(track *Track) (TrackReader, error) {
 		return nil, err
 	}
 	dec := wav.NewDecoder(file)
+	err = dec.FwdToPCM()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	pcmStart, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
 	return WavReader{
-		file:    file,
-		decoder: dec,
+		file:     file,
+		decoder:  dec,
+		pcmStart: pcmStart,
+		pcmEnd:   pcmStart + int64(dec.PCMSize),
 	}, nil
 }
 
+// mp3FrameSize is the size of a frame decoded by go-mp3. From documentation:
+// "The stream is always formatted as 16bit (little endian) 2 channels".
+const mp3FrameSize = 4
+
 type Mp3Reader struct {
 	file    *os.File
 	decoder *mp3.Decoder
@@ -76,27 +138,26 @@ func (m Mp3Reader) Read(p []byte) (n int, err error) {
 	return m.decoder.Read(p)
 }
 
-func (m Mp3Reader) Seek(offset int64, whence int) (int64, error) {
-	return m.decoder.Seek(offset, whence)
+func (m Mp3Reader) Seek(offset time.Duration) error {
+	position := durationToFrames(offset, m.decoder.SampleRate()) * mp3FrameSize
+	_, err := m.decoder.Seek(min(position, m.decoder.Length()), io.SeekStart)
+	return err
 }
 
 func (m Mp3Reader) Close() error {
 	return m.file.Close()
 }
 
-func (m Mp3Reader) Position() (int64, error) {
-	return m.decoder.Seek(0, io.SeekCurrent)
-}
-
-func (m Mp3Reader) Length() (int64, error) {
-	return m.decoder.Length(), nil
+func (m Mp3Reader) Position() (time.Duration, error) {
+	position, err := m.decoder.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	return framesToDuration(position/mp3FrameSize, m.decoder.SampleRate()), nil
 }
 
-func (m Mp3Reader) Duration() (int64, error) {
-	var sampleSize int64 = 4 // From documentation: "The stream is always formatted as 16bit (little endian) 2 channels"
-	length, _ := m.Length()
-	samples := length / sampleSize
-	return samples / int64(m.decoder.SampleRate()), nil
+func (m Mp3Reader) Duration() (time.Duration, error) {
+	return framesToDuration(m.decoder.Length()/mp3FrameSize, m.decoder.SampleRate()), nil
 }
 
 func mp3TrackReader(track *Track) (TrackReader, error) {
@@ -131,31 +192,21 @@ func (o OggReader) Read(p []byte) (n int, err error) {
 	return n * 2, err
 }
 
-func (o OggReader) Seek(position int64, whence int) (int64, error) {
-	_ = whence
-
-	err := o.decoder.SetPosition(position)
-	if err != nil {
-		return 0, err
-	}
-	return position, nil
+func (o OggReader) Seek(offset time.Duration) error {
+	position := durationToFrames(offset, o.decoder.SampleRate())
+	return o.decoder.SetPosition(min(position, o.decoder.Length()))
 }
 
 func (o OggReader) Close() error {
 	return o.file.Close()
 }
 
-func (o OggReader) Position() (int64, error) {
-	return o.decoder.Position(), nil
-}
-
-func (o OggReader) Length() (int64, error) {
-	return o.decoder.Length(), nil
+func (o OggReader) Position() (time.Duration, error) {
+	return framesToDuration(o.decoder.Position(), o.decoder.SampleRate()), nil
 }
 
-func (o OggReader) Duration() (int64, error) {
-	ret, err := audioduration.Duration(o.file, audioduration.TypeOgg)
-	return int64(ret), err
+func (o OggReader) Duration() (time.Duration, error) {
+	return framesToDuration(o.decoder.Length(), o.decoder.SampleRate()), nil
 }
 
 func oggTrackReader(track *Track) (TrackReader, error) {
@@ -174,6 +225,166 @@ func oggTrackReader(track *Track) (TrackReader, error) {
 	}, nil
 }
 
+// FlacReader decodes a FLAC file into little endian PCM data of 2 bytes per
+// sample (up to 16 bits per sample), 3 bytes per sample (up to 24 bits per
+// sample) or 4 bytes per sample.
+type FlacReader struct {
+	file   *os.File
+	stream *flac.Stream
+	// pending holds the decoded but not yet read PCM data
+	pending []byte
+	// offset is the byte offset of the first byte in pending within the
+	// decoded PCM data; it is counted in bytes, as Read may return partial
+	// frames
+	offset int64
+}
+
+// flacBytesPerSample returns the amount of bytes per sample FlacReader
+// produces for the given bits per sample.
+func flacBytesPerSample(bitsPerSample uint8) int {
+	switch {
+	case bitsPerSample <= 16:
+		return 2
+	case bitsPerSample <= 24:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func (f *FlacReader) frameSize() int {
+	return int(f.stream.Info.NChannels) * flacBytesPerSample(f.stream.Info.BitsPerSample)
+}
+
+// decodeFrame decodes the next FLAC frame into pending.
+func (f *FlacReader) decodeFrame() error {
+	frame, err := f.stream.ParseNext()
+	if err != nil {
+		return err
+	}
+	bitsPerSample := f.stream.Info.BitsPerSample
+	bytesPerSample := flacBytesPerSample(bitsPerSample)
+	// align the samples to the most significant bits
+	shift := 8*bytesPerSample - int(bitsPerSample)
+	f.pending = f.pending[:0]
+	for i := range frame.Subframes[0].NSamples {
+		for _, subframe := range frame.Subframes {
+			sample := uint32(subframe.Samples[i] << shift)
+			for b := range bytesPerSample {
+				f.pending = append(f.pending, byte(sample>>(8*b)))
+			}
+		}
+	}
+	return nil
+}
+
+// totalSamples returns the number of samples per channel; zero, if the
+// STREAMINFO does not know it.
+func (f *FlacReader) totalSamples() int64 {
+	return int64(f.stream.Info.NSamples)
+}
+
+func (f *FlacReader) Read(p []byte) (int, error) {
+	// with an unknown length, the decoder reports the end of the stream
+	if total := f.totalSamples(); total != 0 && f.offset >= total*int64(f.frameSize()) {
+		return 0, io.EOF
+	}
+	if len(f.pending) == 0 {
+		err := f.decodeFrame()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *FlacReader) Seek(offset time.Duration) error {
+	position := durationToFrames(offset, int(f.stream.Info.SampleRate))
+	if total := f.totalSamples(); total != 0 && position >= total {
+		// there is nothing left to decode behind the last sample
+		f.pending = f.pending[:0]
+		f.offset = total * int64(f.frameSize())
+		return nil
+	}
+	// flac.Stream.Seek moves to the frame containing the sample, the
+	// samples in front of it are skipped
+	frameStart, err := f.stream.Seek(uint64(position))
+	if err != nil {
+		return err
+	}
+	err = f.decodeFrame()
+	if err != nil {
+		return err
+	}
+	skip := min(int(position-int64(frameStart))*f.frameSize(), len(f.pending))
+	f.pending = f.pending[skip:]
+	f.offset = position * int64(f.frameSize())
+	return nil
+}
+
+func (f *FlacReader) Close() error {
+	return f.file.Close()
+}
+
+func (f *FlacReader) Position() (time.Duration, error) {
+	return framesToDuration(f.offset/int64(f.frameSize()), int(f.stream.Info.SampleRate)), nil
+}
+
+func (f *FlacReader) Duration() (time.Duration, error) {
+	return framesToDuration(f.totalSamples(), int(f.stream.Info.SampleRate)), nil
+}
+
+// flacCountSamples determines the number of samples per channel of a stream,
+// whose STREAMINFO does not know it, by parsing all its frames. It returns a
+// new stream of file at its beginning with the counted number of samples.
+func flacCountSamples(file *os.File, stream *flac.Stream) (*flac.Stream, error) {
+	var samples uint64
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples += uint64(frame.BlockSize)
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	stream, err = flac.NewSeek(file)
+	if err != nil {
+		return nil, err
+	}
+	stream.Info.NSamples = samples
+	return stream, nil
+}
+
+func flacTrackReader(track *Track) (TrackReader, error) {
+	file, err := os.Open(track.Path)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := flac.NewSeek(file)
+	if err == nil && stream.Info.NSamples == 0 {
+		// the STREAMINFO may not know the length (e.g. of streamed
+		// files), which is required for the duration and seeking
+		stream, err = flacCountSamples(file, stream)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FlacReader{
+		file:   file,
+		stream: stream,
+	}, nil
+}
+
 func NewTrackReader(track *Track) (TrackReader, error) {
 	var ret TrackReader
 	var err error
@@ -183,6 +394,8 @@ func NewTrackReader(track *Track) (TrackReader, error) {
 		ret, err = mp3TrackReader(track)
 	case OGG:
 		ret, err = oggTrackReader(track)
+	case FLAC:
+		ret, err = flacTrackReader(track)
 	default:
 		ret, err = wavTrackReader(track)
 	}
@@ -0,0 +1,224 @@
+package godible
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeFlacFile encodes the given samples per channel into a FLAC file.
+func writeFlacFile(t *testing.T, path string, sampleRate uint32, bitsPerSample uint8, samples [][]int32) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  65535,
+		SampleRate:    sampleRate,
+		NChannels:     uint8(len(samples)),
+		BitsPerSample: bitsPerSample,
+	}
+	enc, err := flac.NewEncoder(file, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels := frame.ChannelsMono
+	if len(samples) == 2 {
+		channels = frame.ChannelsLR
+	}
+	// split into frames of 1024 samples, to be able to test seeking
+	blockSize := 1024
+	for start := 0; start < len(samples[0]); start += blockSize {
+		end := min(start+blockSize, len(samples[0]))
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(end - start),
+				SampleRate:        sampleRate,
+				Channels:          channels,
+				BitsPerSample:     bitsPerSample,
+			},
+		}
+		for _, channelSamples := range samples {
+			f.Subframes = append(f.Subframes, &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   channelSamples[start:end],
+				NSamples:  end - start,
+			})
+		}
+		err = enc.WriteFrame(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = enc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlacReader16Bit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stereo.flac")
+	left := make([]int32, 4096)
+	right := make([]int32, 4096)
+	expected := []byte{}
+	for i := range left {
+		left[i] = int32(i)
+		right[i] = -int32(i)
+		expected = append(expected, byte(left[i]), byte(left[i]>>8), byte(right[i]), byte(right[i]>>8))
+	}
+	writeFlacFile(t, path, 32000, 16, [][]int32{left, right})
+
+	track, err := NewTrack(path)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+	expectedMetadata := Metadata{audioFormat: FLAC, bytesPerSample: 2, sampleRate: 32000, channelNum: 2}
+	if *track.metadata != expectedMetadata {
+		t.Errorf("expected metadata %+v; got %+v", expectedMetadata, *track.metadata)
+	}
+	if expected := 128 * time.Millisecond; track.duration != expected {
+		t.Errorf("expected duration %s; got %s", expected, track.duration)
+	}
+
+	reader, err := NewTrackReader(track)
+	if err != nil {
+		t.Fatalf("NewTrackReader failed: %+v", err)
+	}
+	defer reader.Close()
+	pcm, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %+v", err)
+	}
+	if !bytes.Equal(pcm, expected) {
+		t.Errorf("decoded PCM data differs (len %d, expected len %d)", len(pcm), len(expected))
+	}
+
+	// seek into the middle of the second frame
+	err = reader.Seek(framesToDuration(1500, 32000))
+	if err != nil {
+		t.Fatalf("Seek failed: %+v", err)
+	}
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(reader, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, expected[1500*4:1501*4]) {
+		t.Errorf("expected sample 1500 after seeking; got %v", buf)
+	}
+	if position, _ := reader.Position(); position != framesToDuration(1501, 32000) {
+		t.Errorf("expected position of sample 1501; got %s", position)
+	}
+
+	// partial frames are accounted for in the position
+	err = reader.Seek(0)
+	if err != nil {
+		t.Fatalf("Seek failed: %+v", err)
+	}
+	for range 3 {
+		_, err = io.ReadFull(reader, buf[:3])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if position, _ := reader.Position(); position != framesToDuration(2, 32000) {
+		t.Errorf("expected position of sample 2 after reading 9 bytes; got %s", position)
+	}
+
+	// seeking behind the end ends the track
+	err = reader.Seek(time.Hour)
+	if err != nil {
+		t.Fatalf("Seek failed: %+v", err)
+	}
+	if n, err := reader.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF after seeking behind the end; got %d, %+v", n, err)
+	}
+}
+
+func TestFlacReaderUnknownLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "unknown.flac")
+	samples := make([]int32, 3000)
+	writeFlacFile(t, path, 32000, 16, [][]int32{samples})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// clear the 36 bits of the total samples in the STREAMINFO block, which
+	// follows the "fLaC" marker and the block header
+	streamInfo := data[8:]
+	streamInfo[13] &= 0xf0
+	clear(streamInfo[14:18])
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := flacTrackReader(&Track{Path: path})
+	if err != nil {
+		t.Fatalf("flacTrackReader failed: %+v", err)
+	}
+	defer reader.Close()
+	// the length is counted from the frames
+	duration, err := reader.Duration()
+	if expected := framesToDuration(int64(len(samples)), 32000); err != nil || duration != expected {
+		t.Errorf("expected duration %s of a stream of unknown length; got %s (%v)", expected, duration, err)
+	}
+	err = reader.Seek(duration / 2)
+	if err != nil {
+		t.Fatalf("Seek failed: %+v", err)
+	}
+	pcm, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %+v", err)
+	}
+	if len(pcm) != len(samples) {
+		t.Errorf("expected %d bytes behind the middle of a stream of unknown length; got %d", len(samples), len(pcm))
+	}
+}
+
+func TestFlacReader24Bit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mono.flac")
+	// FLAC requires a minimum block size of 16 samples
+	samples := make([]int32, 16)
+	copy(samples, []int32{0x123456, -0x123456, 0x7fffff, -0x800000})
+	writeFlacFile(t, path, 96000, 24, [][]int32{samples})
+
+	track, err := NewTrack(path)
+	if err != nil {
+		t.Fatalf("NewTrack failed: %+v", err)
+	}
+	if track.metadata.bytesPerSample != 3 || track.metadata.channelNum != 1 {
+		t.Errorf("expected 3 bytes per sample and 1 channel; got %+v", *track.metadata)
+	}
+	reader, err := NewTrackReader(track)
+	if err != nil {
+		t.Fatalf("NewTrackReader failed: %+v", err)
+	}
+	defer reader.Close()
+	converter, err := newPCMConverter(reader, trackFormat(track), AudioFormat{SampleRate: 96000, ChannelNum: 2, BytesPerSample: 2})
+	if err != nil {
+		t.Fatalf("newPCMConverter failed: %+v", err)
+	}
+	pcm, err := io.ReadAll(converter)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %+v", err)
+	}
+	expected := []byte{
+		0x34, 0x12, 0x34, 0x12,
+		0xcb, 0xed, 0xcb, 0xed,
+		0xff, 0x7f, 0xff, 0x7f,
+		0x00, 0x80, 0x00, 0x80,
+	}
+	if len(pcm) != 16*4 || !bytes.Equal(pcm[:len(expected)], expected) {
+		t.Errorf("expected converted PCM data %x...; got %x", expected, pcm)
+	}
+}
@@ -0,0 +1,189 @@
+package godible
+
+import (
+	"cmp"
+	"container/list"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SortOrder determines the order of the Tracks within a directory.
+type SortOrder string
+
+const (
+	// SORT_NATURAL sorts by filename, comparing embedded numbers by their
+	// value (i.e. "Chapter 2" precedes "Chapter 10")
+	SORT_NATURAL SortOrder = "natural"
+	// SORT_TAGS sorts by the tags' disc and track number; Tracks without
+	// a track number follow in natural order
+	SORT_TAGS SortOrder = "tags"
+)
+
+// DirectoryOrder determines whether the Tracks of a directory precede the
+// ones of its subdirectories.
+type DirectoryOrder string
+
+const (
+	FILES_FIRST       DirectoryOrder = "files_first"
+	DIRECTORIES_FIRST DirectoryOrder = "directories_first"
+)
+
+func (order SortOrder) valid() bool {
+	return order == SORT_NATURAL || order == SORT_TAGS
+}
+
+func (order DirectoryOrder) valid() bool {
+	return order == FILES_FIRST || order == DIRECTORIES_FIRST
+}
+
+// leadingDigits splits s into its leading decimal digits and the rest.
+func leadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// naturalCompare compares a and b case-insensitively, with embedded numbers
+// compared by their value. Strings differing only in case or leading zeros
+// are ordered bytewise, hence the order is total.
+func naturalCompare(a, b string) int {
+	restA, restB := a, b
+	for restA != "" && restB != "" {
+		numA, afterA := leadingDigits(restA)
+		numB, afterB := leadingDigits(restB)
+		if numA != "" && numB != "" {
+			numA = strings.TrimLeft(numA, "0")
+			numB = strings.TrimLeft(numB, "0")
+			if c := cmp.Compare(len(numA), len(numB)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(numA, numB); c != 0 {
+				return c
+			}
+			restA, restB = afterA, afterB
+			continue
+		}
+		runeA, sizeA := utf8.DecodeRuneInString(restA)
+		runeB, sizeB := utf8.DecodeRuneInString(restB)
+		if c := cmp.Compare(unicode.ToLower(runeA), unicode.ToLower(runeB)); c != 0 {
+			return c
+		}
+		restA, restB = restA[sizeA:], restB[sizeB:]
+	}
+	if c := cmp.Compare(len(restA), len(restB)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// compareTrackNumbers compares the disc and track numbers of a and b. Tags
+// without a track number follow the ones with a track number.
+func compareTrackNumbers(a, b Tags) int {
+	if (a.TrackNumber == 0) != (b.TrackNumber == 0) {
+		if a.TrackNumber == 0 {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(a.DiscNumber, b.DiscNumber); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.TrackNumber, b.TrackNumber)
+}
+
+// compareTracks compares the Tracks a and b directory by directory: sibling
+// directories are ordered naturally, a directory's own Tracks are placed in
+// front of (or behind) its subdirectories according to dirOrder and ordered
+// by order.
+func compareTracks(a, b *Track, order SortOrder, dirOrder DirectoryOrder) int {
+	dirsA := strings.Split(a.DirnameFull(), "/")
+	dirsB := strings.Split(b.DirnameFull(), "/")
+	for i := range min(len(dirsA), len(dirsB)) {
+		if dirsA[i] != dirsB[i] {
+			return naturalCompare(dirsA[i], dirsB[i])
+		}
+	}
+	if len(dirsA) != len(dirsB) {
+		// one Track is located within a subdirectory of the other
+		// Track's directory
+		c := cmp.Compare(len(dirsA), len(dirsB))
+		if dirOrder == DIRECTORIES_FIRST {
+			return -c
+		}
+		return c
+	}
+	if order == SORT_TAGS {
+		if c := compareTrackNumbers(a.Tags(), b.Tags()); c != 0 {
+			return c
+		}
+	}
+	return naturalCompare(filepath.Base(a.Path), filepath.Base(b.Path))
+}
+
+// sortTrackList orders the Tracks of tl. The list's elements are moved, not
+// replaced, hence references to them stay valid.
+func sortTrackList(tl *list.List, order SortOrder, dirOrder DirectoryOrder) {
+	elements := make([]*list.Element, 0, tl.Len())
+	for element := tl.Front(); element != nil; element = element.Next() {
+		elements = append(elements, element)
+	}
+	slices.SortStableFunc(elements, func(a, b *list.Element) int {
+		trackA, _ := a.Value.(*Track)
+		trackB, _ := b.Value.(*Track)
+		if trackA == nil || trackB == nil {
+			return 0
+		}
+		return compareTracks(trackA, trackB, order, dirOrder)
+	})
+	for _, element := range elements {
+		tl.MoveToBack(element)
+	}
+}
+
+// sortTrackList orders the Player's TrackList according to its Settings.
+func (player *Player) sortTrackList() {
+	settings := player.getSettings()
+
+	player.currentMutex.Lock()
+	sortTrackList(player.TrackList, settings.SortOrder, settings.DirectoryOrder)
+	player.currentMutex.Unlock()
+	player.notify()
+}
+
+// SetSortOrder sets and persists the order of the Tracks within a directory
+// and reorders the TrackList accordingly.
+func (player *Player) SetSortOrder(order SortOrder) error {
+	if !order.valid() {
+		return fmt.Errorf("%w: sort order %q", errInvalidArgument, order)
+	}
+	err := player.updateSettings(func(settings *Settings) {
+		settings.SortOrder = order
+	})
+	if err != nil {
+		return err
+	}
+	player.sortTrackList()
+	return nil
+}
+
+// SetDirectoryOrder sets and persists whether a directory's Tracks precede
+// its subdirectories and reorders the TrackList accordingly.
+func (player *Player) SetDirectoryOrder(dirOrder DirectoryOrder) error {
+	if !dirOrder.valid() {
+		return fmt.Errorf("%w: directory order %q", errInvalidArgument, dirOrder)
+	}
+	err := player.updateSettings(func(settings *Settings) {
+		settings.DirectoryOrder = dirOrder
+	})
+	if err != nil {
+		return err
+	}
+	player.sortTrackList()
+	return nil
+}
@@ -0,0 +1,89 @@
+package godible
+
+import (
+	"container/list"
+	"slices"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	sorted := []string{
+		"chapter 1.mp3",
+		"Chapter 2.mp3",
+		"chapter 02.mp3",
+		"chapter 10.mp3",
+		"chapter 10a.mp3",
+		"chapter 100.mp3",
+		"chapter.mp3",
+		"epilog.mp3",
+	}
+	for i := range sorted {
+		for j := range sorted {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			if c := naturalCompare(sorted[i], sorted[j]); c != expected {
+				t.Errorf("naturalCompare(%q, %q): expected %d, got %d", sorted[i], sorted[j], expected, c)
+			}
+		}
+	}
+}
+
+func trackListPaths(tl *list.List) []string {
+	var paths []string
+	for element := tl.Front(); element != nil; element = element.Next() {
+		paths = append(paths, element.Value.(*Track).Path)
+	}
+	return paths
+}
+
+func TestSortTrackList(t *testing.T) {
+	tracks := []*Track{
+		{Path: "/data/b/10.mp3", metadata: &Metadata{tags: Tags{TrackNumber: 1}}},
+		{Path: "/data/b/9.mp3", metadata: &Metadata{tags: Tags{TrackNumber: 2}}},
+		{Path: "/data/b/intro.mp3", metadata: &Metadata{}},
+		{Path: "/data/b/2/1.mp3", metadata: &Metadata{}},
+		{Path: "/data/b/10/1.mp3", metadata: &Metadata{}},
+		{Path: "/data/a/1.mp3", metadata: &Metadata{tags: Tags{TrackNumber: 1, DiscNumber: 2}}},
+		{Path: "/data/a/2.mp3", metadata: &Metadata{tags: Tags{TrackNumber: 2, DiscNumber: 1}}},
+	}
+	tl := list.New()
+	for _, track := range tracks {
+		tl.PushBack(track)
+	}
+	current := tl.Front()
+
+	tests := []struct {
+		order    SortOrder
+		dirOrder DirectoryOrder
+		expected []string
+	}{
+		{SORT_NATURAL, FILES_FIRST, []string{
+			"/data/a/1.mp3", "/data/a/2.mp3",
+			"/data/b/9.mp3", "/data/b/10.mp3", "/data/b/intro.mp3",
+			"/data/b/2/1.mp3", "/data/b/10/1.mp3",
+		}},
+		{SORT_NATURAL, DIRECTORIES_FIRST, []string{
+			"/data/a/1.mp3", "/data/a/2.mp3",
+			"/data/b/2/1.mp3", "/data/b/10/1.mp3",
+			"/data/b/9.mp3", "/data/b/10.mp3", "/data/b/intro.mp3",
+		}},
+		{SORT_TAGS, FILES_FIRST, []string{
+			"/data/a/2.mp3", "/data/a/1.mp3",
+			"/data/b/10.mp3", "/data/b/9.mp3", "/data/b/intro.mp3",
+			"/data/b/2/1.mp3", "/data/b/10/1.mp3",
+		}},
+	}
+	for _, test := range tests {
+		sortTrackList(tl, test.order, test.dirOrder)
+		if paths := trackListPaths(tl); !slices.Equal(paths, test.expected) {
+			t.Errorf("%s, %s: expected %v, got %v", test.order, test.dirOrder, test.expected, paths)
+		}
+	}
+	if current.Value != tracks[0] || tl.Len() != len(tracks) {
+		t.Errorf("expected the list's elements to be moved, not replaced")
+	}
+}
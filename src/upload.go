@@ -0,0 +1,340 @@
+package godible
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// UPLOAD_MAX_SIZE limits the size of an upload request as well as the
+	// total size of the files extracted from its zip archives
+	UPLOAD_MAX_SIZE = 2 << 30
+	// uploadStagingPrefix prefixes the (hidden) staging directories of
+	// uploads
+	uploadStagingPrefix = ".upload-"
+)
+
+var (
+	errUploadTooLarge = errors.New("upload too large")
+	errUploadNoName   = fmt.Errorf("%w: empty file name", errInvalidArgument)
+)
+
+// isHidden reports whether the file or directory at path is hidden. Hidden
+// files (e.g. the staging directories of uploads or the "._" files created
+// by macOS) are not part of the TrackList.
+func isHidden(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// hasHiddenComponent reports whether any directory or file of the relative
+// path rel is hidden.
+func hasHiddenComponent(rel string) bool {
+	for _, component := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(component, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// dataPath returns the path of rel relative to root. Paths leaving root are
+// confined to it, paths containing hidden components are rejected.
+func dataPath(root string, rel string) (string, error) {
+	cleaned := filepath.Clean("/" + rel)
+	if hasHiddenComponent(strings.TrimPrefix(cleaned, "/")) {
+		return "", fmt.Errorf("%w: path %q", errInvalidArgument, rel)
+	}
+	return filepath.Join(root, cleaned), nil
+}
+
+// confinePath fails, if path leads outside of root via symbolic links. As
+// path may not exist yet, its nearest existing ancestor is resolved.
+func confinePath(root string, path string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	existing := filepath.Clean(path)
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) || existing == filepath.Dir(existing) {
+			return err
+		}
+		existing = filepath.Dir(existing)
+	}
+	realPath, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	if !withinPath(realPath, realRoot) {
+		return fmt.Errorf("%w: path %q leads outside of %s", errInvalidArgument, path, root)
+	}
+	return nil
+}
+
+// validateUpload checks whether the uploaded file at path can be played.
+func validateUpload(path string) error {
+	if isDataFile(path) {
+		return fmt.Errorf("reserved file name")
+	}
+	metadata, err := NewMetadata(path)
+	if err != nil {
+		return err
+	}
+	if !sampleRateSupported(metadata.sampleRate) {
+		return fmt.Errorf("unsupported sample rate: %d", metadata.sampleRate)
+	}
+	return nil
+}
+
+// UploadRejection reports an uploaded file which was not accepted.
+type UploadRejection struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// UploadResult reports the outcome of an upload request. The accepted files
+// are given relative to the data directory.
+type UploadResult struct {
+	Accepted []string          `json:"accepted"`
+	Rejected []UploadRejection `json:"rejected"`
+	// Error is set, if the whole upload failed
+	Error string `json:"error,omitempty"`
+}
+
+// stagedFile is a validated file waiting to be moved into place.
+type stagedFile struct {
+	path string
+	// rel is the file's path relative to the upload's target directory
+	rel string
+}
+
+// upload stages the uploaded files in a hidden directory within root,
+// validates them and finally moves the valid ones into the target
+// directory. Staging on the same file system makes the final move atomic,
+// so that the library watcher never sees partially written files.
+type upload struct {
+	root    string
+	target  string
+	staging string
+	staged  []stagedFile
+	// size is the total size of the staged files
+	size   int64
+	result UploadResult
+}
+
+func newUpload(root string, directory string) (*upload, error) {
+	target, err := dataPath(root, directory)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp(root, uploadStagingPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return &upload{
+		root:    root,
+		target:  target,
+		staging: staging,
+		result:  UploadResult{Accepted: []string{}, Rejected: []UploadRejection{}},
+	}, nil
+}
+
+func (u *upload) reject(name string, err error) {
+	slog.Warn("upload: reject file", "name", name, "err", err)
+	u.result.Rejected = append(u.result.Rejected, UploadRejection{Name: name, Error: err.Error()})
+}
+
+// addFile stages the uploaded file name read from r. Zip archives are
+// extracted, keeping their directory structure. Invalid files are rejected;
+// an error is only returned, if the upload can not be continued.
+func (u *upload) addFile(name string, r io.Reader) error {
+	if strings.Trim(filepath.Clean("/"+name), "/") == "" {
+		u.reject(name, errUploadNoName)
+		return nil
+	}
+	name = filepath.Base(filepath.Clean("/" + name))
+	if strings.EqualFold(filepath.Ext(name), ".zip") {
+		return u.addZip(name, r)
+	}
+	return u.stage(name, r)
+}
+
+// stage writes r into the staging directory as file rel (relative to the
+// target directory) and validates it.
+func (u *upload) stage(rel string, r io.Reader) error {
+	path, err := dataPath(u.staging, rel)
+	if err == nil && path == filepath.Clean(u.staging) {
+		err = errUploadNoName
+	}
+	if err != nil {
+		u.reject(rel, err)
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(file, io.LimitReader(r, UPLOAD_MAX_SIZE-u.size+1))
+	errClose := file.Close()
+	u.size += n
+	if err == nil {
+		err = errClose
+	}
+	if err == nil && u.size > UPLOAD_MAX_SIZE {
+		err = errUploadTooLarge
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	err = validateUpload(path)
+	if err != nil {
+		os.Remove(path)
+		u.reject(rel, err)
+		return nil
+	}
+	u.staged = append(u.staged, stagedFile{path: path, rel: strings.TrimPrefix(filepath.Clean("/"+rel), "/")})
+	return nil
+}
+
+// addZip extracts the zip archive name read from r into the staging
+// directory. Hidden files and the resource forks of macOS are skipped.
+func (u *upload) addZip(name string, r io.Reader) error {
+	archive, err := os.CreateTemp(u.staging, ".archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	n, err := io.Copy(archive, io.LimitReader(r, UPLOAD_MAX_SIZE+1))
+	if err != nil {
+		return err
+	}
+	if n > UPLOAD_MAX_SIZE {
+		return errUploadTooLarge
+	}
+	zipReader, err := zip.NewReader(archive, n)
+	if err != nil {
+		u.reject(name, err)
+		return nil
+	}
+	for _, entry := range zipReader.File {
+		if entry.FileInfo().IsDir() || hasHiddenComponent(entry.Name) || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		content, err := entry.Open()
+		if err != nil {
+			u.reject(name+": "+entry.Name, err)
+			continue
+		}
+		err = u.stage(entry.Name, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commit moves the staged files into the target directory. Existing files
+// are not replaced, their uploads are rejected instead.
+func (u *upload) commit() {
+	for _, file := range u.staged {
+		path := filepath.Join(u.target, file.rel)
+		err := confinePath(u.root, path)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0755)
+		}
+		if err == nil {
+			err = renameNoReplace(file.path, path)
+			if errors.Is(err, fs.ErrExist) {
+				err = fmt.Errorf("%w: already exists: %s", errConflict, file.rel)
+			}
+		}
+		if err != nil {
+			u.reject(file.rel, err)
+			continue
+		}
+		slog.Info("upload: accepted file", "path", path)
+		u.result.Accepted = append(u.result.Accepted, strings.TrimPrefix(path, filepath.Clean(u.root)))
+	}
+}
+
+func (u *upload) close() {
+	err := os.RemoveAll(u.staging)
+	if err != nil {
+		slog.Error("upload: removing staging directory failed", "path", u.staging, "err", err)
+	}
+}
+
+// receiveUpload stores the files of a multipart upload within root. The
+// optional form field "directory" selects the target directory relative to
+// root; it has to precede the files, which are sent in the form field
+// "files". The caller has to make root writable.
+func receiveUpload(root string, reader *multipart.Reader) (UploadResult, error) {
+	var u *upload
+	defer func() {
+		if u != nil {
+			u.close()
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return UploadResult{}, err
+		}
+		switch part.FormName() {
+		case "directory":
+			if u != nil {
+				return UploadResult{}, fmt.Errorf("the directory has to precede the files")
+			}
+			directory, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				return UploadResult{}, err
+			}
+			u, err = newUpload(root, string(directory))
+			if err != nil {
+				return UploadResult{}, err
+			}
+		case "files":
+			if u == nil {
+				u, err = newUpload(root, "")
+				if err != nil {
+					return UploadResult{}, err
+				}
+			}
+			err = u.addFile(part.FileName(), part)
+			if err != nil {
+				return UploadResult{}, err
+			}
+		default:
+			slog.Warn("upload: ignore unknown form field", "name", part.FormName())
+		}
+		part.Close()
+	}
+	if u == nil {
+		return UploadResult{}, fmt.Errorf("no files uploaded")
+	}
+	u.commit()
+	return u.result, nil
+}
@@ -0,0 +1,176 @@
+package godible
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDataPath(t *testing.T) {
+	tests := map[string]string{
+		"":               "/data",
+		"books/momo":     "/data/books/momo",
+		"../../etc":      "/data/etc",
+		"/books/../momo": "/data/momo",
+	}
+	for rel, expected := range tests {
+		path, err := dataPath("/data", rel)
+		if err != nil || path != expected {
+			t.Errorf("dataPath(%q): expected %s, got %s (%v)", rel, expected, path, err)
+		}
+	}
+	for _, rel := range []string{".upload-1/x", "books/.hidden"} {
+		if _, err := dataPath("/data", rel); err == nil {
+			t.Errorf("dataPath(%q): expected an error", rel)
+		}
+	}
+}
+
+func TestReceiveUpload(t *testing.T) {
+	root := t.TempDir()
+	wavPath := filepath.Join(t.TempDir(), "track.wav")
+	writeWavFile(t, wavPath, 44100, make([]byte, 4*100))
+	wav, err := os.ReadFile(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	for _, name := range []string{"cd1/01.wav", "cd1/._01.wav", "__MACOSX/cd1/._01.wav", "cover.jpg"} {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := wav
+		if filepath.Ext(name) == ".jpg" {
+			content = []byte("no audio")
+		}
+		entry.Write(content)
+	}
+	zipWriter.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("directory", "../books")
+	for name, content := range map[string][]byte{"a.wav": wav, "notes.txt": []byte("no audio"), "album.zip": archive.Bytes()} {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	writer.Close()
+
+	result, err := receiveUpload(root, multipart.NewReader(&body, writer.Boundary()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(result.Accepted)
+	if !slices.Equal(result.Accepted, []string{"/books/a.wav", "/books/cd1/01.wav"}) {
+		t.Errorf("unexpected accepted files: %v", result.Accepted)
+	}
+	if len(result.Rejected) != 2 {
+		t.Errorf("expected notes.txt and cover.jpg to be rejected, got %v", result.Rejected)
+	}
+	for _, path := range []string{"books/a.wav", "books/cd1/01.wav"} {
+		if _, err := os.Stat(filepath.Join(root, path)); err != nil {
+			t.Errorf("expected %s to be stored: %s", path, err)
+		}
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected the staging directory to be removed, got %v (%v)", entries, err)
+	}
+}
+
+func TestReceiveUploadConfined(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	err := os.Symlink(outside, filepath.Join(root, "outside"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wavPath := filepath.Join(t.TempDir(), "track.wav")
+	writeWavFile(t, wavPath, 44100, make([]byte, 4*100))
+	wav, err := os.ReadFile(wavPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(directory string) UploadResult {
+		t.Helper()
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("directory", directory)
+		part, err := writer.CreateFormFile("files", "a.wav")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(wav)
+		writer.Close()
+		result, err := receiveUpload(root, multipart.NewReader(&body, writer.Boundary()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// symbolic links must not lead outside of root
+	for _, directory := range []string{"outside", "outside/books"} {
+		if result := upload(directory); len(result.Accepted) != 0 || len(result.Rejected) != 1 {
+			t.Errorf("%s: expected the upload to be rejected, got %+v", directory, result)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("expected nothing to be written outside of root, got %v", entries)
+	}
+
+	// existing files are not replaced
+	if result := upload("books"); len(result.Accepted) != 1 {
+		t.Fatalf("expected the upload to be accepted, got %+v", result)
+	}
+	if result := upload("books"); len(result.Accepted) != 0 || len(result.Rejected) != 1 {
+		t.Errorf("expected the upload of an existing file to be rejected, got %+v", result)
+	}
+}
+
+func TestReceiveUploadEmptyName(t *testing.T) {
+	root := t.TempDir()
+	var archive bytes.Buffer
+	zipWriter := zip.NewWriter(&archive)
+	entry, err := zipWriter.Create("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Write([]byte("no name"))
+	zipWriter.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, content := range map[string][]byte{"": []byte("no name"), "album.zip": archive.Bytes()} {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(content)
+	}
+	writer.Close()
+
+	// files without a name are rejected, instead of failing the upload
+	result, err := receiveUpload(root, multipart.NewReader(&body, writer.Boundary()))
+	if err != nil {
+		t.Fatalf("receiveUpload failed: %+v", err)
+	}
+	if len(result.Accepted) != 0 || len(result.Rejected) != 2 {
+		t.Errorf("expected both files to be rejected, got %+v", result)
+	}
+	for _, rejection := range result.Rejected {
+		if rejection.Error != errUploadNoName.Error() {
+			t.Errorf("expected the rejection %q, got %+v", errUploadNoName, rejection)
+		}
+	}
+}
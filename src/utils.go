@@ -1,6 +1,14 @@
 package godible
 
-import "syscall"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
 
 // Reboot syncs the file system cache and performs the default restart.
 func Reboot() {
@@ -27,3 +35,97 @@ func RemountPerm(readonly bool) error {
 	}
 	return syscall.Mount(mountSrc, mountDst, fsType, mountFlags, mountData)
 }
+
+// isOnPerm reports whether path is located on the /perm partition.
+func isOnPerm(path string) bool {
+	return strings.HasPrefix(filepath.Clean(path), "/perm/")
+}
+
+// permMutex protects permWriters.
+var permMutex sync.Mutex
+
+// permWriters is the number of writers currently requiring /perm to be
+// writable (see beginPermWrite).
+var permWriters int
+
+// beginPermWrite remounts /perm writable until the matching endPermWrite.
+// Overlapping writes share the writable window, i.e. the partition is only
+// remounted read-only after the last writer finished.
+func beginPermWrite() error {
+	permMutex.Lock()
+	defer permMutex.Unlock()
+
+	if permWriters == 0 {
+		err := RemountPerm(false)
+		if err != nil {
+			return err
+		}
+	}
+	permWriters++
+	return nil
+}
+
+// endPermWrite ends a write started by beginPermWrite.
+func endPermWrite() error {
+	permMutex.Lock()
+	defer permMutex.Unlock()
+
+	permWriters--
+	if permWriters > 0 {
+		return nil
+	}
+	return RemountPerm(true)
+}
+
+// writePermFile atomically replaces the file at path with data. If path is
+// located on /perm, the partition is remounted writable for the duration of
+// the write and read-only again afterwards.
+func writePermFile(path string, data []byte) error {
+	return writePermFileMode(path, data, 0644)
+}
+
+// writePermFileMode is writePermFile creating the file with the given
+// permissions, e.g. for private keys.
+func writePermFileMode(path string, data []byte, perm os.FileMode) (err error) {
+	if isOnPerm(path) {
+		err = beginPermWrite()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			errRemount := endPermWrite()
+			if err == nil {
+				err = errRemount
+			}
+		}()
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	errClose := file.Close()
+	if err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// renameNoReplace renames src to dst like os.Rename, but atomically fails
+// with an error matching fs.ErrExist instead of replacing an existing dst.
+func renameNoReplace(src string, dst string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, src, unix.AT_FDCWD, dst, unix.RENAME_NOREPLACE)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package godible
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	MIN_VOLUME     = 0
+	MAX_VOLUME     = 100
+	DEFAULT_VOLUME = 50
+	VOLUME_STEP    = 5
+)
+
+func clampVolume(volume int, maxVolume int) int {
+	return max(MIN_VOLUME, min(volume, maxVolume, MAX_VOLUME))
+}
+
+// Volume returns the Player's volume in percent.
+func (player *Player) Volume() int {
+	return int(player.volume.Load())
+}
+
+// MaxVolume returns the Player's maximum volume in percent.
+func (player *Player) MaxVolume() int {
+	return player.getSettings().MaxVolume
+}
+
+// setVolume sets the Player's volume in percent, limited by the maximum
+// volume.
+func (player *Player) setVolume(volume int) {
+	player.volume.Store(int32(clampVolume(volume, player.MaxVolume())))
+}
+
+// SetMaxVolume sets and persists the Player's maximum volume in percent. A
+// louder current volume is reduced accordingly.
+func (player *Player) SetMaxVolume(maxVolume int) error {
+	maxVolume = clampVolume(maxVolume, MAX_VOLUME)
+	err := player.updateSettings(func(settings *Settings) {
+		settings.MaxVolume = maxVolume
+	})
+	if err != nil {
+		return err
+	}
+	player.setVolume(player.Volume())
+	return nil
+}
+
+// gain returns the factor the PCM samples are scaled by. The volume (reduced
+// by a sleep timer's fade-out) is mapped cubically, which roughly matches the
+// perceived loudness.
+func (player *Player) gain() float32 {
+	volume := float32(player.Volume()) / MAX_VOLUME
+	volume *= float32(MAX_VOLUME-player.fadeOut.Load()) / MAX_VOLUME
+	return volume * volume * volume
+}
+
+// volumeWriter scales the 16bit PCM data written to dst by the Player's gain.
+type volumeWriter struct {
+	dst    io.Writer
+	player *Player
+	buf    []byte
+}
+
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	gain := w.player.gain()
+	if gain == 1 {
+		return w.dst.Write(p)
+	}
+	if cap(w.buf) < len(p) {
+		w.buf = make([]byte, len(p))
+	}
+	buf := w.buf[:len(p)]
+	for i := 0; i+1 < len(p); i += 2 {
+		sample := float32(int16(binary.LittleEndian.Uint16(p[i:])))
+		binary.LittleEndian.PutUint16(buf[i:], uint16(int16(sample*gain)))
+	}
+	if len(p)%2 == 1 {
+		buf[len(p)-1] = p[len(p)-1]
+	}
+	return w.dst.Write(buf)
+}
@@ -0,0 +1,94 @@
+package godible
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+func TestVolumeClamping(t *testing.T) {
+	p := newTestPlayer(t)
+	p.settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	p.settings = defaultSettings()
+
+	p.CommandValue(SET_VOLUME, 150)
+	if volume := p.Volume(); volume != MAX_VOLUME {
+		t.Errorf("expected volume %d, got %d", MAX_VOLUME, volume)
+	}
+	p.CommandValue(SET_VOLUME, -10)
+	if volume := p.Volume(); volume != MIN_VOLUME {
+		t.Errorf("expected volume %d, got %d", MIN_VOLUME, volume)
+	}
+	p.Command(VOLUME_UP)
+	if volume := p.Volume(); volume != VOLUME_STEP {
+		t.Errorf("expected volume %d, got %d", VOLUME_STEP, volume)
+	}
+
+	p.CommandValue(SET_VOLUME, 80)
+	err := p.SetMaxVolume(60)
+	if err != nil {
+		t.Fatalf("SetMaxVolume failed: %+v", err)
+	}
+	if volume := p.Volume(); volume != 60 {
+		t.Errorf("expected volume to be reduced to 60, got %d", volume)
+	}
+	p.Command(VOLUME_UP)
+	if volume := p.Volume(); volume != 60 {
+		t.Errorf("expected volume to be limited to 60, got %d", volume)
+	}
+}
+
+func TestMaxVolumePersistence(t *testing.T) {
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+
+	p := newTestPlayer(t)
+	p.settingsPath = settingsPath
+	p.settings = defaultSettings()
+	err := p.SetMaxVolume(70)
+	if err != nil {
+		t.Fatalf("SetMaxVolume failed: %+v", err)
+	}
+
+	settings, err := loadSettings(settingsPath)
+	if err != nil {
+		t.Fatalf("loadSettings failed: %+v", err)
+	}
+	if settings.MaxVolume != 70 {
+		t.Errorf("expected persisted max volume 70, got %d", settings.MaxVolume)
+	}
+}
+
+func TestVolumeWriter(t *testing.T) {
+	p := newTestPlayer(t)
+	p.settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	p.settings = defaultSettings()
+	samples := []int16{1000, -1000, 32767, -32768}
+	pcm := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[2*i:], uint16(sample))
+	}
+
+	for _, tc := range []struct {
+		volume int
+		gain   float32
+	}{
+		{MAX_VOLUME, 1},
+		{50, 0.125},
+		{MIN_VOLUME, 0},
+	} {
+		p.setVolume(tc.volume)
+		var out bytes.Buffer
+		w := &volumeWriter{dst: &out, player: p}
+		n, err := w.Write(pcm)
+		if err != nil || n != len(pcm) {
+			t.Fatalf("volume %d: Write returned %d, %+v", tc.volume, n, err)
+		}
+		for i, sample := range samples {
+			got := int16(binary.LittleEndian.Uint16(out.Bytes()[2*i:]))
+			if expected := int16(float32(sample) * tc.gain); got != expected {
+				t.Errorf("volume %d: expected sample %d, got %d", tc.volume, expected, got)
+			}
+		}
+	}
+}
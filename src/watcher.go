@@ -0,0 +1,259 @@
+package godible
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// WATCH_SETTLE_DURATION is the time a changed file has to stay
+	// unchanged before it is probed; copying a file takes many writes
+	WATCH_SETTLE_DURATION = 2 * time.Second
+	// WATCH_POLL_PERIOD is the period the settled changes are applied in
+	WATCH_POLL_PERIOD = 500 * time.Millisecond
+)
+
+// libraryWatcher keeps the Player's TrackList in sync with the files of a
+// directory tree. As inotify does not watch recursively, every directory of
+// the tree is watched on its own.
+type libraryWatcher struct {
+	player  *Player
+	watcher *fsnotify.Watcher
+	idx     *TrackIndex
+	// pending maps the paths of changed files to the time of their last
+	// change
+	pending map[string]time.Time
+}
+
+// watchLibrary starts watching root and its subdirectories; added, changed
+// and removed files are applied to the TrackList.
+func (player *Player) watchLibrary(root string, idx *TrackIndex) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	w := &libraryWatcher{
+		player:  player,
+		watcher: watcher,
+		idx:     idx,
+		pending: make(map[string]time.Time),
+	}
+	err = w.addDirectory(root, false)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	go w.run()
+	return nil
+}
+
+// addDirectory watches dir and its subdirectories. If scan is true, the
+// files found within are marked as changed, as they may have been created
+// before the directory was watched.
+func (w *libraryWatcher) addDirectory(dir string, scan bool) error {
+	return filepath.WalkDir(dir, func(path string, direntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && isHidden(path) {
+			if direntry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if direntry.IsDir() {
+			return w.watcher.Add(path)
+		}
+		if scan && direntry.Type().IsRegular() {
+			w.pending[path] = time.Now()
+		}
+		return nil
+	})
+}
+
+func (w *libraryWatcher) run() {
+	ticker := time.NewTicker(WATCH_POLL_PERIOD)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("library watcher", "err", err)
+		case <-ticker.C:
+			w.applySettled()
+		}
+	}
+}
+
+func (w *libraryWatcher) handleEvent(event fsnotify.Event) {
+	slog.Debug("library watcher", "event", event)
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) || isHidden(event.Name) {
+		return
+	}
+	if event.Has(fsnotify.Create) {
+		fileinfo, err := os.Stat(event.Name)
+		if err == nil && fileinfo.IsDir() {
+			err = w.addDirectory(event.Name, true)
+			if err != nil {
+				slog.Error("library watcher: watching new directory failed", "path", event.Name, "err", err)
+			}
+			return
+		}
+	}
+	w.pending[event.Name] = time.Now()
+}
+
+// applySettled applies the changes of all files which have not been changed
+// for WATCH_SETTLE_DURATION. During a rescan, the changes are deferred until
+// it swapped the TrackList (see libraryRescan.scanMutex).
+func (w *libraryWatcher) applySettled() {
+	if !w.player.rescan.scanMutex.TryLock() {
+		return
+	}
+	defer w.player.rescan.scanMutex.Unlock()
+
+	applied := false
+	for path, changed := range w.pending {
+		if time.Since(changed) < WATCH_SETTLE_DURATION {
+			continue
+		}
+		// the current Track is not disturbed; its changes are applied
+		// once it is not current anymore
+		if w.apply(path) {
+			delete(w.pending, path)
+			applied = true
+		}
+	}
+	if !applied {
+		return
+	}
+	player := w.player
+	player.rtm.resolve(player.findTrack, player.findDirectoryTrack)
+	player.notify()
+	err := w.idx.Save()
+	if err != nil {
+		slog.Error("saving track index failed", "path", w.idx.path, "err", err)
+	}
+}
+
+// apply adds, updates or removes the Track(s) of path. It returns false, if
+// the change would disturb the current Track.
+func (w *libraryWatcher) apply(path string) bool {
+	fileinfo, err := os.Stat(path)
+	if err != nil {
+		// removed (or renamed) file or directory
+		return w.player.removeTracks(path)
+	}
+	if !fileinfo.Mode().IsRegular() || isDataFile(path) {
+		return true
+	}
+	track := w.idx.lookup(path, fileinfo)
+	if track == nil {
+		track, err = NewTrack(path)
+		if err != nil {
+			slog.Error("library watcher: skip track", "path", path, "err", err)
+			return w.player.removeTracks(path)
+		}
+		w.idx.store(track, fileinfo)
+	}
+	if !sampleRateSupported(track.metadata.sampleRate) {
+		slog.Error("library watcher: skip track: unsupported sample rate", "path", path, "sample rate", track.metadata.sampleRate)
+		return w.player.removeTracks(path)
+	}
+	return w.player.putTrack(track)
+}
+
+// putTrack inserts track into the TrackList at its sorted position. An
+// existing Track of the same path is replaced, keeping its position. It
+// returns false, if the Track to replace is the current one.
+func (player *Player) putTrack(track *Track) bool {
+	settings := player.getSettings()
+
+	player.currentMutex.Lock()
+	var old *Track
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		existing, _ := element.Value.(*Track)
+		if existing == nil || existing.Path != track.Path {
+			continue
+		}
+		if element == player.current {
+			player.currentMutex.Unlock()
+			return false
+		}
+		old = existing
+		player.TrackList.Remove(element)
+		break
+	}
+	if old != nil && old.position <= track.duration {
+		track.position = old.position
+		track.paused = old.paused
+	}
+	inserted := false
+	for element := player.TrackList.Front(); element != nil; element = element.Next() {
+		existing, _ := element.Value.(*Track)
+		if existing != nil && compareTracks(track, existing, settings.SortOrder, settings.DirectoryOrder) < 0 {
+			player.TrackList.InsertBefore(track, element)
+			inserted = true
+			break
+		}
+	}
+	if !inserted {
+		player.TrackList.PushBack(track)
+	}
+	player.currentMutex.Unlock()
+
+	player.notify()
+	if old == nil {
+		slog.Info("library watcher: added track", "track", track.String())
+		return true
+	}
+	player.rtm.replaceTrack(old, track)
+	slog.Info("library watcher: updated track", "track", track.String())
+	return true
+}
+
+// removeTracks removes the Track of path, or all Tracks within the
+// directory path, from the TrackList. The current Track is kept; in this
+// case, removeTracks returns false.
+func (player *Player) removeTracks(path string) bool {
+	var removed []*Track
+	keptCurrent := false
+
+	player.currentMutex.Lock()
+	for element := player.TrackList.Front(); element != nil; {
+		next := element.Next()
+		track, _ := element.Value.(*Track)
+		if track != nil && withinPath(track.Path, path) {
+			if element == player.current {
+				keptCurrent = true
+			} else {
+				player.TrackList.Remove(element)
+				removed = append(removed, track)
+			}
+		}
+		element = next
+	}
+	player.currentMutex.Unlock()
+
+	for _, track := range removed {
+		slog.Info("library watcher: removed track", "track", track.String())
+		player.rtm.forgetTrack(track, player.findDirectoryTrack)
+	}
+	if len(removed) > 0 {
+		player.notify()
+	}
+	return !keptCurrent
+}
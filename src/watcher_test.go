@@ -0,0 +1,107 @@
+package godible
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it holds or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+func TestWatchLibrary(t *testing.T) {
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "data")
+	err := os.Mkdir(dataDir, 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]byte, 4*44100)
+	writeWavFile(t, filepath.Join(dataDir, "2.wav"), 44100, pcm)
+
+	p := newTestPlayer(t)
+	err = CreateTrackList(p.TrackList, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.setCurrent(p.findTrack(filepath.Join(dataDir, "2.wav")))
+	err = p.watchLibrary(dataDir, LoadTrackIndex(filepath.Join(dir, "tracks.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files of new directories are added in sorted order
+	err = os.Mkdir(filepath.Join(dataDir, "b"), 0750)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeWavFile(t, filepath.Join(dataDir, "1.wav"), 44100, pcm)
+	writeWavFile(t, filepath.Join(dataDir, "b", "1.wav"), 44100, pcm)
+	expected := []string{
+		filepath.Join(dataDir, "1.wav"),
+		filepath.Join(dataDir, "2.wav"),
+		filepath.Join(dataDir, "b", "1.wav"),
+	}
+	if !waitFor(t, 10*time.Second, func() bool { return len(p.tracks()) == len(expected) }) {
+		t.Fatalf("expected the new tracks to be added, got %v", p.tracks())
+	}
+	for i, track := range p.tracks() {
+		if track.Path != expected[i] {
+			t.Errorf("expected %s at index %d, got %s", expected[i], i, track.Path)
+		}
+	}
+
+	// the current track is kept until it is not current anymore
+	err = os.RemoveAll(filepath.Join(dataDir, "b"))
+	if err == nil {
+		err = os.Remove(filepath.Join(dataDir, "2.wav"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !waitFor(t, 10*time.Second, func() bool { return len(p.tracks()) == 2 }) {
+		t.Fatalf("expected the removed tracks to be removed, got %v", p.tracks())
+	}
+	if current := p.getCurrent(); current == nil || current.Path != expected[1] {
+		t.Errorf("expected the current track to be kept, got %s", current)
+	}
+	p.setCurrentNext()
+	if !waitFor(t, 10*time.Second, func() bool { return len(p.tracks()) == 1 }) {
+		t.Errorf("expected the former current track to be removed, got %v", p.tracks())
+	}
+}
+
+func TestRemoveTracksRemapsRfid(t *testing.T) {
+	p := newTestPlayer(t, "/d/1.wav", "/d/2.wav", "/e/1.wav")
+	tracks := p.tracks()
+	p.rtm.UidTrackMap["dir"] = &TrackMapping{Track: tracks[1], Directory: "/d"}
+	p.rtm.UidTrackMap["track"] = &TrackMapping{Track: tracks[2]}
+
+	p.removeTracks("/d/2.wav")
+	p.removeTracks("/e")
+	if track := p.rtm.GetTrack("dir"); track != tracks[0] {
+		t.Errorf("expected the directory mapping to continue at %s, got %s", tracks[0], track)
+	}
+	if _, ok := p.rtm.GetMapping("track"); ok {
+		t.Errorf("expected the mapping of the removed track to be unresolved")
+	}
+
+	// the mapping is resolved again, once its track exists again
+	readded := &Track{Path: "/e/1.wav"}
+	p.putTrack(readded)
+	p.rtm.resolve(p.findTrack, p.findDirectoryTrack)
+	if track := p.rtm.GetTrack("track"); track != readded {
+		t.Errorf("expected the mapping to be resolved again, got %s", track)
+	}
+}
@@ -0,0 +1,190 @@
+package godible
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// WS_WRITE_WAIT is the time allowed to write a message to a client
+	WS_WRITE_WAIT = 10 * time.Second
+	// WS_PONG_WAIT is the time allowed to read the next message (or pong)
+	// from a client; silent clients are considered dead afterwards
+	WS_PONG_WAIT = 60 * time.Second
+	// WS_PING_PERIOD is the period pings are sent in; it has to be less
+	// than WS_PONG_WAIT
+	WS_PING_PERIOD = WS_PONG_WAIT * 9 / 10
+	// WS_MAX_MESSAGE_SIZE limits the size of a message from a client
+	WS_MAX_MESSAGE_SIZE = 64 << 10
+)
+
+// wsHub tracks the connected websocket clients. Each client receives the
+// events of the Player's eventBus through its own bounded queue (see
+// subscription); a client lagging behind is dropped.
+type wsHub struct {
+	mutex   sync.Mutex
+	clients map[*wsClient]bool
+	events  *eventBus
+	// changed is called, if a client connects or disconnects
+	changed func()
+}
+
+// wsClient is a websocket connection of the wsHub.
+type wsClient struct {
+	hub  *wsHub
+	conn *websocket.Conn
+	sub  *subscription
+	// snapshot are the events sent first, see eventBus.subscribe
+	snapshot []WebsocketApiRequest
+	// done is closed on unregistering the client
+	done chan struct{}
+}
+
+func newWsHub(events *eventBus, changed func()) *wsHub {
+	return &wsHub{
+		clients: make(map[*wsClient]bool),
+		events:  events,
+		changed: changed,
+	}
+}
+
+// count returns the number of connected clients.
+func (hub *wsHub) count() int {
+	if hub == nil {
+		return 0
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return len(hub.clients)
+}
+
+// register adds the connection as client; the caller has to run its
+// readPump and writePump.
+func (hub *wsHub) register(conn *websocket.Conn) *wsClient {
+	sub, snapshot := hub.events.subscribe()
+	client := &wsClient{
+		hub:      hub,
+		conn:     conn,
+		sub:      sub,
+		snapshot: snapshot,
+		done:     make(chan struct{}),
+	}
+	hub.mutex.Lock()
+	hub.clients[client] = true
+	count := len(hub.clients)
+	hub.mutex.Unlock()
+
+	slog.Info("websocket client connected", "remote", conn.RemoteAddr(), "clients", count)
+	hub.changed()
+	return client
+}
+
+// unregister removes the client and closes its connection. It may be called
+// repeatedly, e.g. by both the readPump and the writePump.
+func (hub *wsHub) unregister(client *wsClient) {
+	hub.mutex.Lock()
+	if !hub.clients[client] {
+		hub.mutex.Unlock()
+		return
+	}
+	delete(hub.clients, client)
+	count := len(hub.clients)
+	hub.mutex.Unlock()
+
+	hub.events.unsubscribe(client.sub)
+	close(client.done)
+	client.conn.Close()
+	slog.Info("websocket client disconnected", "remote", client.conn.RemoteAddr(), "clients", count)
+	hub.changed()
+}
+
+// readPump passes the client's requests to handle until the connection
+// fails or the client stops answering pings.
+func (client *wsClient) readPump(handle func(WebsocketApiRequest)) {
+	defer client.hub.unregister(client)
+
+	conn := client.conn
+	conn.SetReadLimit(WS_MAX_MESSAGE_SIZE)
+	conn.SetReadDeadline(time.Now().Add(WS_PONG_WAIT))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(WS_PONG_WAIT))
+	})
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Error("websocket read failed", "remote", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(WS_PONG_WAIT))
+
+		var req WebsocketApiRequest
+		err = json.Unmarshal(message, &req)
+		if err != nil {
+			slog.Error("failed to decode message as WebsocketApiRequest", "message", message, "err", err)
+			continue
+		}
+		handle(req)
+	}
+}
+
+// writePump sends the snapshot, the subsequent events and the pings to the
+// client until it is unregistered or dropped for lagging behind.
+func (client *wsClient) writePump() {
+	defer client.hub.unregister(client)
+
+	ticker := time.NewTicker(WS_PING_PERIOD)
+	defer ticker.Stop()
+	for _, event := range client.snapshot {
+		if !client.write(event) {
+			return
+		}
+	}
+	client.snapshot = nil
+	for {
+		select {
+		case event, ok := <-client.sub.events:
+			if !ok {
+				// dropped by the eventBus; the client reconnects
+				// and starts over with a snapshot
+				client.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_WAIT))
+				client.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"))
+				return
+			}
+			if !client.write(event) {
+				return
+			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_WAIT))
+			err := client.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				slog.Error("websocket ping failed", "remote", client.conn.RemoteAddr(), "err", err)
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
+
+func (client *wsClient) write(event WebsocketApiRequest) bool {
+	message, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("marshalling websocket message failed", "type", event.Type, "err", err)
+		return true
+	}
+	client.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_WAIT))
+	err = client.conn.WriteMessage(websocket.TextMessage, message)
+	if err != nil {
+		slog.Error("websocket write failed", "remote", client.conn.RemoteAddr(), "type", event.Type, "err", err)
+		return false
+	}
+	return true
+}
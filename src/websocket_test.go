@@ -0,0 +1,63 @@
+package godible
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWsHub(t *testing.T) {
+	p := newPlayerHandlerPassthrough(newLibraryTestPlayer(t, "a/1.wav"))
+	server := httptest.NewServer(http.HandlerFunc(p.wsHandler))
+	defer server.Close()
+
+	waitForCount := func(expected int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for p.hub.count() != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d clients, got %d", expected, p.hub.count())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForCount(2)
+	if clients := p.state().Clients; clients != 2 {
+		t.Errorf("expected the state to report 2 clients, got %d", clients)
+	}
+
+	second.Close()
+	waitForCount(1)
+
+	// a client dropped by the eventBus for lagging behind is disconnected
+	p.hub.mutex.Lock()
+	for client := range p.hub.clients {
+		p.events.unsubscribe(client.sub)
+	}
+	p.hub.mutex.Unlock()
+	first.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err = first.ReadMessage()
+		if err != nil {
+			break
+		}
+	}
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+	waitForCount(0)
+}